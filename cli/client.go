@@ -0,0 +1,320 @@
+/*
+File: client.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-12 17:05:41
+
+Description: 子命令 'get' 和 'put' 的实现
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/yhyj/skynet/general"
+)
+
+// progressBar 在终端中显示单个文件的传输进度
+type progressBar struct {
+	name      string    // 文件名
+	start     time.Time // 开始时间
+	startDone int64     // 开始时已传输的字节数（断点续传时不为 0）
+	last      time.Time // 上次刷新时间
+	lastDone  int64     // 上次刷新时已传输的字节数
+	started   bool      // 是否已开始
+}
+
+// progressBarWidth 进度条的宽度（字符数）
+const progressBarWidth = 25
+
+// update 刷新进度，最多每 200 毫秒刷新一次
+//
+// 参数：
+//   - done: 已传输的字节数
+//   - total: 总字节数
+func (pb *progressBar) update(done, total int64) {
+	now := time.Now()
+	if !pb.started {
+		pb.started, pb.start, pb.startDone = true, now, done
+	}
+	if done < total && now.Sub(pb.last) < 200*time.Millisecond || done == total && pb.lastDone == total {
+		return
+	}
+	pb.last, pb.lastDone = now, done
+
+	percent := int64(100)
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	filled := int(percent) * progressBarWidth / 100
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	speed, eta := float64(0), "--:--"
+	if elapsed := now.Sub(pb.start).Seconds(); elapsed > 0 {
+		speed = float64(done-pb.startDone) / elapsed
+	}
+	if speed > 0 {
+		remaining := time.Duration(float64(total-done)/speed) * time.Second
+		eta = fmt.Sprintf("%02d:%02d", int(remaining.Minutes()), int(remaining.Seconds())%60)
+	}
+
+	name := pb.name
+	if len(name) > 30 {
+		name = "..." + name[len(name)-27:]
+	}
+	color.Printf("\r%-30s %3d%% [%s] %9s / %-9s %9s/s ETA %s", name, percent, bar, general.FormatSize(done), general.FormatSize(total), general.FormatSize(int64(speed)), eta)
+}
+
+// finish 结束进度显示并换行
+func (pb *progressBar) finish() {
+	if pb.started {
+		color.Println()
+	}
+}
+
+// printClientError 输出客户端错误信息
+//
+// 参数：
+//   - name: 出错的文件，可以为空
+//   - err: 错误信息
+func printClientError(name string, err error) {
+	fileName, lineNo := general.GetCallerInfo()
+	if name != "" {
+		color.Printf("%s %s %s: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), name, err)
+	} else {
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+	}
+}
+
+// ListRemote 列出远程 skynet 服务中的目录
+//
+// 参数：
+//   - rawURL: 服务地址，路径部分指定要列出的目录
+//   - options: 客户端配置
+func ListRemote(rawURL string, options general.ClientOptions) {
+	client, remotePath, err := general.NewClient(rawURL, options)
+	if err != nil {
+		printClientError("", err)
+		os.Exit(1)
+	}
+	listing, err := client.List(remotePath)
+	if err != nil {
+		printClientError(remotePath, err)
+		os.Exit(1)
+	}
+
+	color.Printf("%s\n", general.FgCyanText(listing.Path))
+	for _, entry := range listing.Entries {
+		size := general.FormatSize(entry.Size)
+		name := entry.Name
+		if entry.IsDir {
+			size = "-"
+			name = general.FgBlueText(entry.Name + "/")
+		}
+		color.Printf("%10s  %s  %s\n", size, general.SecondaryText(entry.ModTime.Local().Format("2006-01-02 15:04:05")), name)
+	}
+}
+
+// GetRemote 从远程 skynet 服务下载文件或目录，支持断点续传
+//
+// 参数：
+//   - rawURL: 服务地址，路径部分指定要下载的文件或目录
+//   - output: 保存下载内容的本地目录
+//   - options: 客户端配置
+func GetRemote(rawURL, output string, options general.ClientOptions) {
+	client, remotePath, err := general.NewClient(rawURL, options)
+	if err != nil {
+		printClientError("", err)
+		os.Exit(1)
+	}
+	entry, err := client.Stat(remotePath)
+	if err != nil {
+		printClientError(remotePath, err)
+		os.Exit(1)
+	}
+
+	// 远程服务返回的名称不可信，清理后再用作本地文件名
+	name := ""
+	if remotePath != "/" {
+		if name, err = general.SanitizeFileName(entry.Name); err != nil {
+			printClientError(entry.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	failed := 0
+	if entry.IsDir {
+		failed = downloadDir(client, remotePath, filepath.Join(output, name))
+	} else if err := os.MkdirAll(output, os.ModePerm); err != nil {
+		printClientError(output, err)
+		failed++
+	} else if !downloadFile(client, entry, filepath.Join(output, name)) {
+		failed++
+	}
+
+	if failed > 0 {
+		color.Printf("%s\n", general.DangerText(failed, " file(s) failed"))
+		os.Exit(1)
+	}
+}
+
+// downloadDir 递归下载远程目录
+//
+// 参数：
+//   - client: 客户端
+//   - remoteDir: 远程目录路径
+//   - localDir: 本地目录路径
+//
+// 返回：
+//   - 下载失败的文件数
+func downloadDir(client *general.Client, remoteDir, localDir string) int {
+	if err := os.MkdirAll(localDir, os.ModePerm); err != nil {
+		printClientError(localDir, err)
+		return 1
+	}
+	listing, err := client.List(remoteDir)
+	if err != nil {
+		printClientError(remoteDir, err)
+		return 1
+	}
+
+	failed := 0
+	for index := range listing.Entries {
+		entry := &listing.Entries[index]
+		// 远程服务返回的名称不可信，清理后再用作本地文件名
+		name, err := general.SanitizeFileName(entry.Name)
+		if err != nil {
+			printClientError(entry.Path, err)
+			failed++
+			continue
+		}
+		if entry.IsDir {
+			failed += downloadDir(client, path.Join(remoteDir, entry.Name), filepath.Join(localDir, name))
+		} else if !downloadFile(client, entry, filepath.Join(localDir, name)) {
+			failed++
+		}
+	}
+	return failed
+}
+
+// downloadFile 下载单个远程文件，本地已存在大小相同的文件时跳过
+//
+// 参数：
+//   - client: 客户端
+//   - entry: 远程文件信息
+//   - localPath: 本地文件路径
+//
+// 返回：
+//   - 是否下载成功
+func downloadFile(client *general.Client, entry *general.APIEntry, localPath string) bool {
+	if fileInfo, err := os.Stat(localPath); err == nil && fileInfo.Mode().IsRegular() && fileInfo.Size() == entry.Size {
+		// 启用校验时只跳过内容一致的文件
+		if !client.Options().Verify || client.VerifyChecksum(entry.Path, localPath) == nil {
+			color.Printf("%-30s %s\n", entry.Name, general.SecondaryText("already exists, skipped"))
+			return true
+		}
+	}
+
+	bar := &progressBar{name: entry.Name}
+	err := client.Download(entry.Path, localPath, bar.update)
+	bar.finish()
+	if err != nil {
+		printClientError(entry.Path, err)
+		return false
+	}
+	return true
+}
+
+// PutRemote 将本地文件或目录上传到远程 skynet 服务，支持断点续传
+//
+// 参数：
+//   - rawURL: 服务地址，路径部分指定上传到的远程目录
+//   - paths: 要上传的本地文件或目录
+//   - options: 客户端配置
+func PutRemote(rawURL string, paths []string, options general.ClientOptions) {
+	client, remoteDir, err := general.NewClient(rawURL, options)
+	if err != nil {
+		printClientError("", err)
+		os.Exit(1)
+	}
+
+	failed := 0
+	for _, localPath := range paths {
+		fileInfo, err := os.Stat(localPath)
+		if err != nil {
+			printClientError(localPath, err)
+			failed++
+			continue
+		}
+		baseName := filepath.Base(filepath.Clean(localPath))
+		if !fileInfo.IsDir() {
+			if !uploadFile(client, localPath, path.Join(remoteDir, baseName)) {
+				failed++
+			}
+			continue
+		}
+
+		// 上传目录时保留目录结构，符号链接指向的目录不会被遍历
+		err = filepath.WalkDir(localPath, func(filePath string, dirEntry fs.DirEntry, err error) error {
+			if err != nil {
+				printClientError(filePath, err)
+				failed++
+				return nil
+			}
+			if dirEntry.IsDir() {
+				return nil
+			}
+			if fileInfo, err := os.Stat(filePath); err != nil || !fileInfo.Mode().IsRegular() {
+				return nil
+			}
+			relativePath, err := filepath.Rel(localPath, filePath)
+			if err != nil {
+				return err
+			}
+			if !uploadFile(client, filePath, path.Join(remoteDir, baseName, filepath.ToSlash(relativePath))) {
+				failed++
+			}
+			return nil
+		})
+		if err != nil {
+			printClientError(localPath, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		color.Printf("%s\n", general.DangerText(failed, " file(s) failed"))
+		os.Exit(1)
+	}
+}
+
+// uploadFile 上传单个本地文件
+//
+// 参数：
+//   - client: 客户端
+//   - localPath: 本地文件路径
+//   - remotePath: 远程文件路径
+//
+// 返回：
+//   - 是否上传成功
+func uploadFile(client *general.Client, localPath, remotePath string) bool {
+	bar := &progressBar{name: filepath.Base(localPath)}
+	result, err := client.Upload(localPath, remotePath, bar.update)
+	bar.finish()
+	if err != nil {
+		printClientError(localPath, err)
+		return false
+	}
+	if "/"+result.Name != remotePath {
+		color.Printf("%-30s %s\n", filepath.Base(localPath), general.SecondaryText("saved as ", result.Name))
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+/*
+File: config.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-07-18 10:52:17
+
+Description: 子命令 'config' 的实现
+*/
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/gookit/color"
+	"github.com/yhyj/skynet/general"
+)
+
+// CreateConfigFile 使用默认值创建配置文件
+//
+// 参数：
+//   - configFile: 配置文件路径
+//   - force: 配置文件已存在时是否覆盖
+func CreateConfigFile(configFile string, force bool) {
+	if general.FileExist(configFile) && !force {
+		color.Printf("%s %s\n", general.WarnText("Configuration file already exists:"), general.FgCyanText(configFile))
+		color.Printf("%s\n", general.CommentText("Use '--force' to overwrite it."))
+		return
+	}
+
+	if err := general.WriteConfig(configFile, general.DefaultConfig()); err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		return
+	}
+	color.Printf("%s %s\n", general.SuccessText("Create configuration file:"), general.FgCyanText(configFile))
+}
+
+// PrintConfigFile 打印配置文件内容
+//
+// 参数：
+//   - configFile: 配置文件路径
+func PrintConfigFile(configFile string) {
+	if !general.FileExist(configFile) {
+		color.Printf("%s %s\n", general.WarnText("Configuration file not found:"), general.FgCyanText(configFile))
+		color.Printf("%s\n", general.CommentText("Use '--create' to create it."))
+		return
+	}
+
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		return
+	}
+	color.Printf("%s\n", general.FgCyanText(configFile))
+	color.Printf("%s\n", general.LightText(string(content)))
+}
+
+// EditConfigFile 使用 $EDITOR 编辑配置文件，配置文件不存在时先使用默认值创建
+//
+// 参数：
+//   - configFile: 配置文件路径
+func EditConfigFile(configFile string) {
+	if !general.FileExist(configFile) {
+		CreateConfigFile(configFile, false)
+	} else if err := os.Chmod(configFile, general.ConfigFileMode); err != nil {
+		// 收紧旧版本创建的配置文件的权限，编辑器保存时会保留该权限
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+	}
+
+	// 获取编辑器
+	editor := general.GetVariable("EDITOR")
+	if editor == "" {
+		if general.Platform == "windows" {
+			editor = "notepad"
+		} else {
+			editor = "vi"
+		}
+	}
+
+	command := exec.Command(editor, configFile)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		return
+	}
+
+	// 检查编辑后的配置文件是否有效
+	if _, err := general.LoadConfig(configFile); err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s Invalid configuration file: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+	}
+}
@@ -0,0 +1,42 @@
+/*
+File: discover.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-14 15:48:06
+
+Description: 子命令 'discover' 的实现
+*/
+
+package cli
+
+import (
+	"os"
+	"time"
+
+	"github.com/gookit/color"
+	"github.com/yhyj/skynet/general"
+)
+
+// DiscoverServers 查找并输出局域网中正在运行的 HTTP 文件服务
+//
+// 参数：
+//   - timeout: 等待响应的时间
+func DiscoverServers(timeout time.Duration) {
+	color.Printf("%s\n", general.CommentText("Searching for ", general.DiscoveryService, " servers on the local network..."))
+	servers, err := general.Discover(timeout)
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		os.Exit(1)
+	}
+	if len(servers) == 0 {
+		color.Printf("%s\n", general.FgYellowText("No servers found"))
+		return
+	}
+
+	// 输出格式为：[序号] 实例名 URL 服务类型 认证方式 主机名
+	for index, server := range servers {
+		color.Printf("%s %s %s\n", general.FgGreenText("[", index+1, "]"), general.LightText(server.Instance), general.FgBlueText(server.URL()))
+		color.Printf("    %s %s  %s %s  %s %s\n", general.SecondaryText("mode:"), server.Mode, general.SecondaryText("auth:"), server.Auth, general.SecondaryText("host:"), server.Hostname)
+	}
+}
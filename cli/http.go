@@ -10,8 +10,13 @@ Description: 子命令 'http' 的实现
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gookit/color"
 	"github.com/yhyj/skynet/general"
@@ -20,10 +25,12 @@ import (
 // StartHttp 启动 HTTP 服务
 //
 // 参数：
-//   - port: 服务端口
-//   - dir: 服务目录
+//   - config: 配置，命令行参数已覆盖配置文件中的对应项
 //   - interactive: 交互模式
-func StartHttp(port int, dir string, interactive bool) {
+func StartHttp(config *general.Config, interactive bool) {
+	port := config.Http.Port
+	dir := config.Http.Dir
+
 	// 如果 port 范围不在 [1, 65535] 内，则使用默认值 8080
 	if port < 1 || port > 65535 {
 		port = 8080
@@ -35,7 +42,7 @@ func StartHttp(port int, dir string, interactive bool) {
 		os.Exit(1)
 	}
 
-	if dir == "PWD" {
+	if dir == "" || dir == "PWD" {
 		dir = general.GetVariable("PWD")
 	}
 	// 使用 dir 参数
@@ -53,7 +60,7 @@ func StartHttp(port int, dir string, interactive bool) {
 	// 网卡编号
 	var netInterfaceNumber int
 	// 可用服务类型
-	serviceSlice := map[int]string{1: "Download", 2: "Upload", 3: "All"}
+	serviceSlice := map[int]string{1: general.ModeDownload, 2: general.ModeUpload, 3: general.ModeAll}
 	// 服务类型编号
 	var serviceNumber int
 
@@ -89,24 +96,196 @@ func StartHttp(port int, dir string, interactive bool) {
 			color.Warn.Printf("Invalid service number, using default service <%s>\n", serviceSlice[serviceNumber])
 		}
 		color.Println()
-	} else { // 默认模式
-		netInterfaceNumber = 1
-		serviceNumber = 3
+	} else { // 默认模式，使用配置中的网卡和服务类型
+		netInterfaceNumber = 0
+		for number, netInterfaceData := range netInterfacesData {
+			if netInterfaceData["name"] == config.Http.Interface || (config.Http.Interface == "" && number == 1) {
+				netInterfaceNumber = number
+				break
+			}
+		}
+		if netInterfaceNumber == 0 && config.Http.Bind == "" {
+			fileName, lineNo := general.GetCallerInfo()
+			color.Printf("%s %s No such network interface: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), config.Http.Interface)
+			os.Exit(1)
+		}
+
+		if config.Http.Mode == "" {
+			config.Http.Mode = general.ModeAll
+		}
+		serviceMode, err := general.ParseServiceMode(config.Http.Mode)
+		if err != nil {
+			fileName, lineNo := general.GetCallerInfo()
+			color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+			os.Exit(1)
+		}
+		for number, service := range serviceSlice {
+			if service == serviceMode {
+				serviceNumber = number
+			}
+		}
 	}
-	// 获取 address 参数
+	// 获取 address 参数，非交互模式下指定的 IP 优先于网卡
 	address := netInterfacesData[netInterfaceNumber]["ip"]
+	if !interactive && config.Http.Bind != "" {
+		address = config.Http.Bind
+	}
+
+	// 获取上传表单内存限制
+	maxMemory, err := general.ParseSize(config.Upload.MaxMemory)
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		os.Exit(1)
+	}
+
+	// 获取上传限制
+	limits, err := general.ParseUploadLimits(config.Upload)
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		os.Exit(1)
+	}
+
+	// 获取关闭服务时等待传输结束的最长时间
+	shutdownTimeout, err := time.ParseDuration(config.Http.ShutdownTimeout)
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		os.Exit(1)
+	}
+
+	// 获取操作权限，交互模式下使用所选服务类型的默认权限
+	var permissions general.Permissions
+	if !interactive {
+		if permissions, err = general.ParsePermissions(config.Http.Permissions); err != nil {
+			fileName, lineNo := general.GetCallerInfo()
+			color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+			os.Exit(1)
+		}
+	}
+
+	// 生成访问令牌
+	var token string
+	if config.Auth.Token {
+		if token, err = general.GenerateToken(); err != nil {
+			fileName, lineNo := general.GetCallerInfo()
+			color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+			os.Exit(1)
+		}
+	}
+
+	// 打开访问日志
+	accessLog, closeAccessLog, err := general.OpenAccessLog(config.Log)
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s Unable to open access log: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		return
+	}
+	defer closeAccessLog()
 
 	// 启动 http server
-	switch serviceSlice[serviceNumber] {
-	case "Download":
-		general.HttpDownloadServerForCLI(address, color.Sprint(port), absDir)
-	case "Upload":
-		general.HttpUploadServerForCLI(address, color.Sprint(port), absDir)
-	case "All":
-		general.HttpAllServerForCLI(address, color.Sprint(port), absDir)
-	default:
+	fileServer, err := general.NewFileServer(general.ServerOptions{
+		Mode:        serviceSlice[serviceNumber],
+		Permissions: permissions,
+		Address:     address,
+		Port:        color.Sprint(port),
+		Dir:         absDir,
+		MaxMemory:   maxMemory,
+		Limits:      limits,
+		OnConflict:  config.Upload.OnConflict,
+		Username:    config.Auth.Username,
+		Password:    config.Auth.Password,
+		Token:       token,
+		TLS:         config.TLS.Enable,
+		CertFile:    config.TLS.Cert,
+		KeyFile:     config.TLS.Key,
+		ThemeDir:    config.Http.ThemeDir,
+		AccessLog:   accessLog,
+		LogFormat:   config.Log.Format,
+	})
+	if err != nil {
 		fileName, lineNo := general.GetCallerInfo()
-		color.Printf("%s %s Unable to start service: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), serviceSlice[serviceNumber])
+		color.Printf("%s %s Unable to start service: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
 		return
 	}
+	if err := fileServer.Start(context.Background()); err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+		return
+	}
+
+	// 成功后输出服务信息
+	url := fileServer.ShareURL()
+	color.Info.Tips("Starting HTTP [%s] server at '%s'", general.SuccessText(serviceSlice[serviceNumber]), general.FgCyanText(absDir)) // 服务地址
+	color.Info.Tips("HTTP server url is %s", general.FgBlueText(url))                                                                  // URL
+	if fingerprint := fileServer.Fingerprint(); fingerprint != "" {
+		color.Info.Tips("Certificate SHA-256 fingerprint is %s", general.FgYellowText(fingerprint)) // 证书指纹
+	}
+	color.Info.Tips("Permissions: %s", general.FgYellowText(fileServer.Options().Permissions)) // 操作权限
+	if limits.MaxSize > 0 {
+		color.Info.Tips("Maximum upload size is %s", general.FgYellowText(general.FormatSize(limits.MaxSize))) // 上传大小限制
+	}
+	if limits.Quota > 0 {
+		color.Info.Tips("Storage quota is %s", general.FgYellowText(general.FormatSize(limits.Quota))) // 存储配额
+	}
+	if config.Auth.Password != "" {
+		color.Info.Tips("Password authentication is enabled") // 密码认证
+	}
+	if token != "" {
+		color.Info.Tips("Access token is required, share the url or QR code below") // 访问令牌
+	}
+	// 在局域网中广播服务，失败时不影响服务运行
+	var advertiser *general.Advertiser
+	if config.Http.Advertise {
+		if advertiser, err = fileServer.Advertise(); err != nil {
+			color.Warn.Tips("Unable to advertise on the local network: %s", err)
+		} else {
+			defer advertiser.Close()
+			color.Info.Tips("Advertising as %s on the local network", general.FgYellowText(general.DiscoveryService))
+		}
+	}
+	codeString, err := general.QrCodeString(url) // 二维码
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+	} else {
+		color.Printf("\n%s\n", codeString)
+	}
+	if config.Log.File != "" {
+		color.Info.Tips("Writing access log to %s", general.FgCyanText(config.Log.File)) // 访问日志文件
+	}
+	color.Printf("%s\n", general.CommentText("Press Ctrl+C to stop.")) // 服务停止快捷键
+
+	// 等待服务结束或收到退出信号
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	serverDone := make(chan error, 1)
+	go func() { serverDone <- fileServer.Wait() }()
+	select {
+	case err = <-serverDone:
+	case <-signals:
+		// 恢复默认处理，再次按下 Ctrl+C 时立即退出
+		signal.Stop(signals)
+		color.Printf("\n")
+		// 先停止广播，避免关闭期间仍被发现
+		if advertiser != nil {
+			advertiser.Close()
+		}
+		color.Info.Tips("Shutting down, waiting up to %s for active transfers (press Ctrl+C again to quit immediately)", general.FgYellowText(shutdownTimeout))
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		err = fileServer.Shutdown(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			color.Warn.Tips("Timed out waiting for active transfers, unfinished transfers were aborted")
+			err = nil
+		}
+	}
+	if err != nil {
+		fileName, lineNo := general.GetCallerInfo()
+		color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+	} else {
+		color.Printf("HTTP Server closed\n")
+	}
+	color.Info.Tips("Transfers: %s", general.FgCyanText(fileServer.Transfers())) // 传输统计
 }
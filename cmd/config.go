@@ -0,0 +1,54 @@
+/*
+File: config.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-07-18 10:40:03
+
+Description: 执行子命令 'config'
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/yhyj/skynet/cli"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Operate configuration file",
+	Long:  `Create, print or edit the configuration file of the program.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 解析参数
+		configFile, _ := cmd.Flags().GetString("config")
+		createFlag, _ := cmd.Flags().GetBool("create")
+		forceFlag, _ := cmd.Flags().GetBool("force")
+		printFlag, _ := cmd.Flags().GetBool("print")
+		editFlag, _ := cmd.Flags().GetBool("edit")
+
+		// 执行配置文件操作
+		if createFlag {
+			cli.CreateConfigFile(configFile, forceFlag)
+		}
+		if editFlag {
+			cli.EditConfigFile(configFile)
+		}
+		if printFlag {
+			cli.PrintConfigFile(configFile)
+		}
+		if !createFlag && !editFlag && !printFlag {
+			cmd.Help()
+		}
+	},
+}
+
+func init() {
+	configCmd.Flags().Bool("create", false, "Create a default configuration file")
+	configCmd.Flags().Bool("force", false, "Overwrite existing configuration file")
+	configCmd.Flags().Bool("print", false, "Print configuration file content")
+	configCmd.Flags().Bool("edit", false, "Edit configuration file with $EDITOR")
+
+	configCmd.Flags().BoolP("help", "h", false, "help for config command")
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,38 @@
+/*
+File: discover.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-14 15:40:52
+
+Description: 执行子命令 'discover'
+*/
+
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yhyj/skynet/cli"
+)
+
+// discoverCmd represents the discover command
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "Find skynet servers on the local network",
+	Long:  `Find running skynet http servers on the local network via mDNS/DNS-SD and print their URLs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// 解析参数
+		timeoutFlag, _ := cmd.Flags().GetDuration("timeout")
+
+		// 查找服务
+		cli.DiscoverServers(timeoutFlag)
+	},
+}
+
+func init() {
+	discoverCmd.Flags().Duration("timeout", 3*time.Second, "How long to wait for responses")
+
+	discoverCmd.Flags().BoolP("help", "h", false, "help for discover command")
+	rootCmd.AddCommand(discoverCmd)
+}
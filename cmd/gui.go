@@ -28,6 +28,14 @@ var guiCmd = &cobra.Command{
 			errorSlogan []string // 错误标语
 		)
 
+		// 读取配置文件
+		configFile, _ := cmd.Flags().GetString("config")
+		config, err := general.LoadConfig(configFile)
+		if err != nil {
+			log.Println(general.FgRedText("Unable to load configuration file: ", err))
+			config = general.DefaultConfig()
+		}
+
 		// 检查平台
 		if general.Platform == "linux" {
 			// 检查是否远程连接
@@ -37,7 +45,7 @@ var guiCmd = &cobra.Command{
 					log.Println(general.FgRedText(err))
 				}
 				// 启动 GUI
-				gui.StartGraphicalUserInterface()
+				gui.StartGraphicalUserInterface(config)
 			} else {
 				errorSlogan = append(errorSlogan, "Could not connect to display")
 			}
@@ -47,14 +55,14 @@ var guiCmd = &cobra.Command{
 				log.Println(general.FgRedText(err))
 			}
 			// 启动 GUI
-			gui.StartGraphicalUserInterface()
+			gui.StartGraphicalUserInterface(config)
 		} else if general.Platform == "darwin" {
 			// 设置字体
 			if err := gui.SetFont(); err != nil {
 				log.Println(general.FgRedText(err))
 			}
 			// 启动 GUI
-			gui.StartGraphicalUserInterface()
+			gui.StartGraphicalUserInterface(config)
 		} else {
 			errorSlogan = append(errorSlogan, "Current platform is not supported")
 		}
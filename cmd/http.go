@@ -10,8 +10,14 @@ Description: 执行子命令 'http'
 package cmd
 
 import (
+	"net"
+	"os"
+	"time"
+
+	"github.com/gookit/color"
 	"github.com/spf13/cobra"
 	"github.com/yhyj/skynet/cli"
+	"github.com/yhyj/skynet/general"
 )
 
 // httpCmd represents the http command
@@ -21,18 +27,201 @@ var httpCmd = &cobra.Command{
 	Long:  `Start an http server and manage its life cycle.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// 解析参数
+		configFile, _ := cmd.Flags().GetString("config")
 		portFlag, _ := cmd.Flags().GetInt("port")
 		dirFlag, _ := cmd.Flags().GetString("dir")
+		modeFlag, _ := cmd.Flags().GetString("mode")
+		bindFlag, _ := cmd.Flags().GetString("bind")
+		interfaceFlag, _ := cmd.Flags().GetString("interface")
+		onConflictFlag, _ := cmd.Flags().GetString("on-conflict")
+		maxUploadSizeFlag, _ := cmd.Flags().GetString("max-upload-size")
+		quotaFlag, _ := cmd.Flags().GetString("quota")
+		minFreeSpaceFlag, _ := cmd.Flags().GetString("min-free-space")
+		permissionsFlag, _ := cmd.Flags().GetStringSlice("permissions")
+		allowModifyFlag, _ := cmd.Flags().GetBool("allow-modify")
+		usernameFlag, _ := cmd.Flags().GetString("username")
+		passwordFlag, _ := cmd.Flags().GetString("password")
+		tokenFlag, _ := cmd.Flags().GetBool("token")
+		tlsFlag, _ := cmd.Flags().GetBool("tls")
+		certFlag, _ := cmd.Flags().GetString("cert")
+		keyFlag, _ := cmd.Flags().GetString("key")
+		advertiseFlag, _ := cmd.Flags().GetBool("advertise")
+		themeDirFlag, _ := cmd.Flags().GetString("theme-dir")
+		shutdownTimeoutFlag, _ := cmd.Flags().GetDuration("shutdown-timeout")
+		accessLogFlag, _ := cmd.Flags().GetBool("access-log")
+		logFormatFlag, _ := cmd.Flags().GetString("log-format")
+		logFileFlag, _ := cmd.Flags().GetString("log-file")
+		logMaxSizeFlag, _ := cmd.Flags().GetString("log-max-size")
+		logMaxBackupsFlag, _ := cmd.Flags().GetInt("log-max-backups")
 		interactiveFlag, _ := cmd.Flags().GetBool("interactive")
 
+		// 读取配置文件
+		config, err := general.LoadConfig(configFile)
+		if err != nil {
+			fileName, lineNo := general.GetCallerInfo()
+			color.Printf("%s %s Unable to load configuration file: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+			os.Exit(1)
+		}
+
+		// 命令行参数优先于配置文件
+		if cmd.Flags().Changed("port") {
+			config.Http.Port = portFlag
+		}
+		if cmd.Flags().Changed("dir") {
+			config.Http.Dir = dirFlag
+		}
+		if cmd.Flags().Changed("mode") {
+			mode, err := general.ParseServiceMode(modeFlag)
+			if err != nil {
+				fileName, lineNo := general.GetCallerInfo()
+				color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+				os.Exit(1)
+			}
+			config.Http.Mode = mode
+		}
+		if cmd.Flags().Changed("permissions") {
+			if _, err := general.ParsePermissions(permissionsFlag); err != nil {
+				fileName, lineNo := general.GetCallerInfo()
+				color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+				os.Exit(1)
+			}
+			config.Http.Permissions = permissionsFlag
+		}
+		// 允许修改时在已有权限的基础上开启删除、重命名、移动和创建目录
+		if allowModifyFlag {
+			permissions, err := general.ParsePermissions(config.Http.Permissions)
+			if err != nil {
+				fileName, lineNo := general.GetCallerInfo()
+				color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+				os.Exit(1)
+			}
+			if permissions == (general.Permissions{}) {
+				mode, _ := general.ParseServiceMode(config.Http.Mode)
+				permissions = general.ModePermissions(mode)
+			}
+			config.Http.Permissions = permissions.WithModify().Names()
+		}
+		if cmd.Flags().Changed("on-conflict") {
+			onConflict, err := general.ParseConflictPolicy(onConflictFlag)
+			if err != nil {
+				fileName, lineNo := general.GetCallerInfo()
+				color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+				os.Exit(1)
+			}
+			config.Upload.OnConflict = onConflict
+		}
+		if cmd.Flags().Changed("max-upload-size") {
+			config.Upload.MaxSize = maxUploadSizeFlag
+		}
+		if cmd.Flags().Changed("quota") {
+			config.Upload.Quota = quotaFlag
+		}
+		if cmd.Flags().Changed("min-free-space") {
+			config.Upload.MinFreeSpace = minFreeSpaceFlag
+		}
+		if cmd.Flags().Changed("interface") {
+			config.Http.Interface = interfaceFlag
+			config.Http.Bind = "" // 命令行指定的网卡优先于配置文件中的 IP
+		}
+		if cmd.Flags().Changed("bind") {
+			if net.ParseIP(bindFlag) == nil {
+				fileName, lineNo := general.GetCallerInfo()
+				color.Printf("%s %s Invalid IP address: %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), bindFlag)
+				os.Exit(1)
+			}
+			config.Http.Bind = bindFlag
+		}
+
+		if cmd.Flags().Changed("advertise") {
+			config.Http.Advertise = advertiseFlag
+		}
+		if cmd.Flags().Changed("theme-dir") {
+			config.Http.ThemeDir = themeDirFlag
+		}
+		if cmd.Flags().Changed("shutdown-timeout") {
+			config.Http.ShutdownTimeout = shutdownTimeoutFlag.String()
+		}
+
+		if cmd.Flags().Changed("username") {
+			config.Auth.Username = usernameFlag
+		}
+		if cmd.Flags().Changed("password") {
+			config.Auth.Password = passwordFlag
+		}
+		if cmd.Flags().Changed("token") {
+			config.Auth.Token = tokenFlag
+		}
+		if cmd.Flags().Changed("tls") {
+			config.TLS.Enable = tlsFlag
+		}
+		// 指定证书时隐含启用 HTTPS
+		if cmd.Flags().Changed("cert") {
+			config.TLS.Cert = certFlag
+			config.TLS.Enable = true
+		}
+		if cmd.Flags().Changed("key") {
+			config.TLS.Key = keyFlag
+			config.TLS.Enable = true
+		}
+
+		if cmd.Flags().Changed("access-log") {
+			config.Log.Access = accessLogFlag
+		}
+		if cmd.Flags().Changed("log-format") {
+			logFormat, err := general.ParseLogFormat(logFormatFlag)
+			if err != nil {
+				fileName, lineNo := general.GetCallerInfo()
+				color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+				os.Exit(1)
+			}
+			config.Log.Format = logFormat
+		}
+		if cmd.Flags().Changed("log-file") {
+			config.Log.File = logFileFlag
+		}
+		if cmd.Flags().Changed("log-max-size") {
+			if _, err := general.ParseSize(logMaxSizeFlag); err != nil {
+				fileName, lineNo := general.GetCallerInfo()
+				color.Printf("%s %s %s\n", general.DangerText(general.ErrorInfoFlag), general.SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+				os.Exit(1)
+			}
+			config.Log.MaxSize = logMaxSizeFlag
+		}
+		if cmd.Flags().Changed("log-max-backups") {
+			config.Log.MaxBackups = logMaxBackupsFlag
+		}
+
 		// 启动 HTTP 服务 CLI 版本
-		cli.StartHttp(portFlag, dirFlag, interactiveFlag)
+		cli.StartHttp(config, interactiveFlag)
 	},
 }
 
 func init() {
 	httpCmd.Flags().Int("port", 8080, "Port to listen on")
 	httpCmd.Flags().String("dir", "PWD", "Directory to serve")
+	httpCmd.Flags().String("mode", general.ModeAll, "Service mode: download, upload or all")
+	httpCmd.Flags().String("bind", "", "IP address to bind, takes precedence over --interface")
+	httpCmd.Flags().String("interface", "any", "Network interface name to bind, 'any' means 0.0.0.0")
+	httpCmd.Flags().StringSlice("permissions", nil, "Comma-separated permissions: read, upload, delete, rename, mkdir (default depends on --mode)")
+	httpCmd.Flags().Bool("allow-modify", false, "Allow deleting, renaming, moving files and creating folders from the web UI")
+	httpCmd.Flags().String("on-conflict", general.ConflictRename, "Policy when an uploaded file already exists: rename, overwrite or reject")
+	httpCmd.Flags().String("max-upload-size", "", "Maximum size of a single upload (one file, or one form submission), e.g. 4GB, unlimited if empty")
+	httpCmd.Flags().String("quota", "", "Maximum total size of all files in the served directory, e.g. 50GB, unlimited if empty")
+	httpCmd.Flags().String("min-free-space", "100MB", "Reject uploads that would leave less free disk space than this")
+	httpCmd.Flags().String("username", "", "Username for HTTP basic authentication, any username is accepted if empty")
+	httpCmd.Flags().String("password", "", "Password for HTTP basic authentication, authentication is disabled if empty")
+	httpCmd.Flags().Bool("token", false, "Generate a random access token and include it in the printed URL and QR code")
+	httpCmd.Flags().Bool("tls", false, "Serve over HTTPS, a self-signed certificate is generated unless --cert and --key are given")
+	httpCmd.Flags().String("cert", "", "PEM certificate file for HTTPS, implies --tls")
+	httpCmd.Flags().String("key", "", "PEM private key file for HTTPS, implies --tls")
+	httpCmd.Flags().Bool("advertise", true, "Advertise the server on the local network via mDNS, use --advertise=false to disable")
+	httpCmd.Flags().String("theme-dir", "", "Directory with page templates and static files that override the built-in web UI")
+	httpCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "How long to wait for active transfers on Ctrl+C before aborting them")
+	httpCmd.Flags().Bool("access-log", true, "Print an access log line for every request, use --access-log=false to disable")
+	httpCmd.Flags().String("log-format", general.LogFormatText, "Access log format: text or json")
+	httpCmd.Flags().String("log-file", "", "Also write the access log to this file, rotated by size")
+	httpCmd.Flags().String("log-max-size", "10MB", "Maximum size of the access log file before it is rotated")
+	httpCmd.Flags().Int("log-max-backups", 5, "Number of rotated access log files to keep")
 	httpCmd.Flags().Bool("interactive", false, "Start interactive mode")
 
 	httpCmd.Flags().BoolP("help", "h", false, "help for http command")
@@ -0,0 +1,51 @@
+/*
+File: put.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-12 16:52:03
+
+Description: 执行子命令 'put'
+*/
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/yhyj/skynet/cli"
+	"github.com/yhyj/skynet/general"
+)
+
+// putCmd represents the put command
+var putCmd = &cobra.Command{
+	Use:   "put URL FILE...",
+	Short: "Upload files to a skynet server",
+	Long: `Upload files or directories to another skynet http server.
+
+The path in URL selects the remote directory, for example:
+  skynet put http://192.168.1.10:8080/ report.pdf photos/
+  skynet put "http://192.168.1.10:8080/backup/?token=<token>" notes.txt
+
+Interrupted uploads are resumed on the next run.`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		// 解析参数
+		insecureFlag, _ := cmd.Flags().GetBool("insecure")
+		fingerprintFlag, _ := cmd.Flags().GetString("fingerprint")
+		verifyFlag, _ := cmd.Flags().GetBool("verify")
+
+		cli.PutRemote(args[0], args[1:], general.ClientOptions{
+			Insecure:    insecureFlag,
+			Fingerprint: fingerprintFlag,
+			Verify:      verifyFlag,
+		})
+	},
+}
+
+func init() {
+	putCmd.Flags().BoolP("insecure", "k", false, "Skip HTTPS certificate verification")
+	putCmd.Flags().String("fingerprint", "", "Trust the HTTPS certificate with this SHA-256 fingerprint")
+	putCmd.Flags().Bool("verify", false, "Send the SHA-256 checksum of each file so the server verifies it")
+
+	putCmd.Flags().BoolP("help", "h", false, "help for put command")
+	rootCmd.AddCommand(putCmd)
+}
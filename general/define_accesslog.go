@@ -0,0 +1,400 @@
+/*
+File: define_accesslog.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-19 10:12:44
+
+Description: HTTP 服务访问日志
+*/
+
+package general
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 访问日志格式
+const (
+	LogFormatText = "text" // 每行一条的文本
+	LogFormatJSON = "json" // 每行一个 JSON 对象
+)
+
+// LogFormats 支持的访问日志格式
+var LogFormats = []string{LogFormatText, LogFormatJSON}
+
+// ParseLogFormat 校验访问日志格式，不区分大小写
+//
+// 参数：
+//   - format: 日志格式
+//
+// 返回：
+//   - 标准日志格式
+//   - 错误信息
+func ParseLogFormat(format string) (string, error) {
+	for _, logFormat := range LogFormats {
+		if strings.EqualFold(logFormat, format) {
+			return logFormat, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported log format: %s", format)
+}
+
+// AccessLogEntry 一条访问日志
+type AccessLogEntry struct {
+	Time     time.Time `json:"time"`        // 请求开始时间
+	ClientIP string    `json:"client_ip"`   // 客户端 IP
+	User     string    `json:"user"`        // HTTP Basic 认证用户名，未提供时为 "-"
+	Method   string    `json:"method"`      // 请求方法
+	Path     string    `json:"path"`        // 请求路径和参数，访问令牌已隐藏
+	Status   int       `json:"status"`      // 响应状态码
+	Bytes    int64     `json:"bytes"`       // 响应体字节数
+	Duration float64   `json:"duration_ms"` // 处理时间（毫秒）
+}
+
+// String 返回文本格式的访问日志
+//
+// 返回：
+//   - 文本格式的访问日志，不含换行符
+func (e AccessLogEntry) String() string {
+	return fmt.Sprintf("%s %s %s %s %q %d %d %.1fms",
+		e.Time.Format("2006-01-02 15:04:05"), e.ClientIP, e.User, e.Method, e.Path, e.Status, e.Bytes, e.Duration)
+}
+
+// accessLogger 将访问日志写入输出，控制并发写入
+type accessLogger struct {
+	writer io.Writer  // 日志输出
+	format string     // 日志格式
+	mutex  sync.Mutex // 互斥锁，确保每条日志完整写入
+}
+
+// write 写入一条访问日志
+//
+// 参数：
+//   - entry: 访问日志
+func (l *accessLogger) write(entry AccessLogEntry) {
+	var line []byte
+	if l.format == LogFormatJSON {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	} else {
+		line = []byte(entry.String() + "\n")
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.writer.Write(line)
+}
+
+// withAccessLog 为请求处理器添加访问日志，未通过认证的请求同样会被记录
+//
+// 参数：
+//   - next: 请求处理器
+//
+// 返回：
+//   - 记录访问日志的请求处理器
+func (fs *FileServer) withAccessLog(next http.Handler) http.Handler {
+	if fs.options.AccessLog == nil {
+		return next
+	}
+	logger := &accessLogger{writer: fs.options.AccessLog, format: fs.options.LogFormat}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			user := "-"
+			if username, _, ok := r.BasicAuth(); ok && username != "" {
+				user = username
+			}
+			logger.write(AccessLogEntry{
+				Time:     start,
+				ClientIP: clientIP(r),
+				User:     user,
+				Method:   r.Method,
+				Path:     redactedRequestURI(r),
+				Status:   recorder.status(),
+				Bytes:    recorder.bytes,
+				Duration: float64(time.Since(start).Microseconds()) / 1000,
+			})
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// statusRecorder 记录响应状态码和响应体字节数
+type statusRecorder struct {
+	http.ResponseWriter       // 原始响应
+	code                int   // 响应状态码，未写入时为 0
+	bytes               int64 // 响应体字节数
+}
+
+// WriteHeader 写入响应状态码
+//
+// 参数：
+//   - code: 响应状态码
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Write 写入响应体
+//
+// 参数：
+//   - data: 数据
+//
+// 返回：
+//   - 写入的字节数
+//   - 错误信息
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(data)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom 从 src 读取响应体，保留原始响应的零拷贝优化
+//
+// 参数：
+//   - src: 数据来源
+//
+// 返回：
+//   - 写入的字节数
+//   - 错误信息
+func (s *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	var n int64
+	var err error
+	if readerFrom, ok := s.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(src)
+	} else {
+		n, err = io.Copy(struct{ io.Writer }{s.ResponseWriter}, src)
+	}
+	s.bytes += n
+	return n, err
+}
+
+// Flush 将缓冲的数据发送到客户端
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap 返回原始响应，供 http.ResponseController 使用
+//
+// 返回：
+//   - 原始响应
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// status 返回响应状态码，未写入任何内容时为 200
+//
+// 返回：
+//   - 响应状态码
+func (s *statusRecorder) status() int {
+	if s.code == 0 {
+		return http.StatusOK
+	}
+	return s.code
+}
+
+// clientIP 返回客户端 IP，不信任 X-Forwarded-For 等可伪造的请求头
+//
+// 参数：
+//   - r: 请求
+//
+// 返回：
+//   - 客户端 IP
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// redactedRequestURI 返回请求路径和参数，访问令牌替换为 "REDACTED"
+//
+// 参数：
+//   - r: 请求
+//
+// 返回：
+//   - 请求路径和参数
+func redactedRequestURI(r *http.Request) string {
+	query := r.URL.Query()
+	if query.Has(TokenParam) {
+		query.Set(TokenParam, "REDACTED")
+		location := *r.URL
+		location.RawQuery = query.Encode()
+		return location.RequestURI()
+	}
+	return r.URL.RequestURI()
+}
+
+// RotatingFile 按大小轮转的日志文件，可安全地并发写入
+//
+// 文件超过 maxSize 时重命名为 "<文件名>.1"，已有的 "<文件名>.1" 重命名为 "<文件名>.2"，依此类推，
+// 最多保留 maxBackups 个旧文件
+type RotatingFile struct {
+	path       string     // 文件路径
+	maxSize    int64      // 单个文件的最大字节数，小于等于 0 时不轮转
+	maxBackups int        // 最多保留的旧文件数
+	file       *os.File   // 当前文件
+	size       int64      // 当前文件的字节数
+	mutex      sync.Mutex // 互斥锁，控制对文件的并发访问
+}
+
+// NewRotatingFile 打开按大小轮转的日志文件，文件已存在时追加写入，所在目录不存在时自动创建
+//
+// 参数：
+//   - path: 文件路径
+//   - maxSize: 单个文件的最大字节数，小于等于 0 时不轮转
+//   - maxBackups: 最多保留的旧文件数
+//
+// 返回：
+//   - 日志文件
+//   - 错误信息
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rotatingFile := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := rotatingFile.open(); err != nil {
+		return nil, err
+	}
+	return rotatingFile, nil
+}
+
+// open 以追加方式打开当前文件
+//
+// 返回：
+//   - 错误信息
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, fileInfo.Size()
+	return nil
+}
+
+// Write 写入数据，写入后超过最大字节数时先轮转文件
+//
+// 参数：
+//   - data: 数据
+//
+// 返回：
+//   - 写入的字节数
+//   - 错误信息
+func (f *RotatingFile) Write(data []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(data)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate 轮转文件，调用前需要持有互斥锁
+//
+// 返回：
+//   - 错误信息
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", f.path, f.maxBackups))
+		for index := f.maxBackups - 1; index >= 1; index-- {
+			os.Rename(fmt.Sprintf("%s.%d", f.path, index), fmt.Sprintf("%s.%d", f.path, index+1))
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close 关闭文件
+//
+// 返回：
+//   - 错误信息
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// OpenAccessLog 根据配置打开访问日志输出
+//
+// 参数：
+//   - config: 访问日志配置
+//
+// 返回：
+//   - 访问日志输出，不输出到标准输出且未指定日志文件时为 nil
+//   - 关闭日志文件的函数，总是非 nil
+//   - 错误信息
+func OpenAccessLog(config LogConfig) (io.Writer, func() error, error) {
+	var writers []io.Writer
+	closeFunc := func() error { return nil }
+	if config.Access {
+		writers = append(writers, os.Stdout)
+	}
+	if config.File != "" {
+		maxSize, err := ParseSize(config.MaxSize)
+		if err != nil {
+			return nil, closeFunc, err
+		}
+		rotatingFile, err := NewRotatingFile(config.File, maxSize, config.MaxBackups)
+		if err != nil {
+			return nil, closeFunc, err
+		}
+		writers = append(writers, rotatingFile)
+		closeFunc = rotatingFile.Close
+	}
+	if len(writers) == 0 {
+		return nil, closeFunc, nil
+	}
+	return io.MultiWriter(writers...), closeFunc, nil
+}
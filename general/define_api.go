@@ -0,0 +1,198 @@
+/*
+File: define_api.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-09 10:17:44
+
+Description: JSON API
+*/
+
+package general
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// APIPrefix JSON API 的路径前缀
+const APIPrefix = "/api/v1"
+
+// APIEntry JSON API 返回的文件或目录信息
+type APIEntry struct {
+	Name    string    `json:"name"`             // 名称
+	Path    string    `json:"path"`             // 相对于服务目录的路径，以 "/" 开头，目录以 "/" 结尾
+	IsDir   bool      `json:"is_dir"`           // 是否是目录
+	Size    int64     `json:"size"`             // 大小（字节），目录为 0
+	ModTime time.Time `json:"mod_time"`         // 修改时间
+	SHA256  string    `json:"sha256,omitempty"` // SHA-256 校验和，仅在请求参数 checksum=sha256 时返回，目录为空
+}
+
+// APIListing JSON API 返回的目录列表
+type APIListing struct {
+	Path    string     `json:"path"`    // 目录相对于服务目录的路径，以 "/" 开头和结尾
+	Entries []APIEntry `json:"entries"` // 目录中的项
+}
+
+// apiRoutes 注册 JSON API 路由
+//
+// 接口：
+//   - GET /api/v1/list?path=<目录>&sort=<name|size|time>&order=<asc|desc>&checksum=sha256: 列出目录，checksum 可选，指定时返回文件的校验和
+//   - GET /api/v1/stat?path=<路径>&checksum=sha256: 查询文件或目录信息，checksum 可选
+//   - POST /api/v1/upload: 以 multipart/form-data 上传文件，字段与上传页面相同，path 字段需要位于对应的 file 字段之前
+//   - PUT /api/v1/upload?path=<路径>: 以请求体作为文件内容上传单个文件，可以在 X-Checksum 头中给出 SHA-256 校验和
+//   - POST /api/v1/delete、/api/v1/rename、/api/v1/move、/api/v1/mkdir: 参数与页面中的文件操作相同
+//
+// 所有接口都以 JSON 格式返回结果，错误时包含 error 字段
+//
+// 参数：
+//   - mux: 路由
+func (fs *FileServer) apiRoutes(mux *http.ServeMux) {
+	mux.HandleFunc(APIPrefix+"/list", apiJSON(fs.require(PermRead, fs.handleAPIList)))
+	mux.HandleFunc(APIPrefix+"/stat", apiJSON(fs.require(PermRead, fs.handleAPIStat)))
+	mux.HandleFunc(APIPrefix+"/upload", apiJSON(fs.require(PermUpload, fs.handleAPIUpload)))
+	mux.HandleFunc(APIPrefix+"/delete", apiJSON(fs.require(PermDelete, fs.handleDelete)))
+	mux.HandleFunc(APIPrefix+"/rename", apiJSON(fs.require(PermRename, fs.handleRename)))
+	mux.HandleFunc(APIPrefix+"/move", apiJSON(fs.require(PermRename, fs.handleMove)))
+	mux.HandleFunc(APIPrefix+"/mkdir", apiJSON(fs.require(PermMkdir, fs.handleMkdir)))
+	mux.HandleFunc(APIPrefix+"/", apiJSON(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Unknown API"})
+	}))
+}
+
+// apiJSON 使请求处理函数总是以 JSON 格式返回结果
+//
+// 参数：
+//   - handler: 请求处理函数
+//
+// 返回：
+//   - 请求处理函数
+func apiJSON(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Accept", "application/json")
+		handler(w, r)
+	}
+}
+
+// handleAPIList 以 JSON 格式列出目录
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleAPIList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := CleanURLPath(query.Get("path"))
+	if hasInternalSegment(name) {
+		writeJSONError(w, os.ErrNotExist)
+		return
+	}
+	checksum, err := wantsChecksum(query.Get("checksum"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	isDir, err := isDirectory(fs.root, name)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	if !isDir {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Not a directory"})
+		return
+	}
+
+	listing, err := ReadListing(fs.root, name, "", query.Get("sort"), query.Get("order"))
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	result := APIListing{Path: listing.Path, Entries: []APIEntry{}}
+	for _, entry := range listing.Entries {
+		apiEntry := APIEntry{
+			Name:    entry.Name,
+			Path:    entry.Path,
+			IsDir:   entry.IsDir,
+			Size:    entry.Size,
+			ModTime: entry.ModTime,
+		}
+		if checksum && !entry.IsDir {
+			if apiEntry.SHA256, err = fs.fileChecksum(entry.Path); err != nil {
+				writeJSONError(w, err)
+				return
+			}
+		}
+		result.Entries = append(result.Entries, apiEntry)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleAPIStat 以 JSON 格式返回文件或目录信息
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleAPIStat(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := CleanURLPath(query.Get("path"))
+	if hasInternalSegment(name) {
+		writeJSONError(w, os.ErrNotExist)
+		return
+	}
+	checksum, err := wantsChecksum(query.Get("checksum"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	file, fileInfo, err := openFile(fs.root, name)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	file.Close()
+
+	entry := APIEntry{
+		Name:    path.Base(name),
+		Path:    name,
+		IsDir:   fileInfo.IsDir(),
+		Size:    fileInfo.Size(),
+		ModTime: fileInfo.ModTime(),
+	}
+	if entry.IsDir {
+		entry.Size = 0
+		if name != "/" {
+			entry.Path += "/"
+		}
+	} else if checksum {
+		if entry.SHA256, err = fs.fileChecksum(name); err != nil {
+			writeJSONError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// handleAPIUpload 以 JSON 格式返回上传结果
+//
+// 请求方法为 POST 时与上传页面相同；为 PUT 时以请求体作为文件内容，请求参数 path 指定文件相对于服务目录的路径
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		fs.handleUpload(w, r)
+	case http.MethodPut:
+		result, err := fs.saveFile(r.URL.Query().Get("path"), r.Body, r.ContentLength, r.Header.Get(ChecksumHeader))
+		if err != nil {
+			status, _ := operationErrorStatus(err)
+			writeJSON(w, status, UploadSummary{Failed: 1, Results: []UploadResult{result}})
+			return
+		}
+		writeJSON(w, http.StatusCreated, UploadSummary{Succeeded: 1, Results: []UploadResult{result}})
+	default:
+		w.Header().Set("Allow", "POST, PUT")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+}
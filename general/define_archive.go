@@ -0,0 +1,205 @@
+/*
+File: define_archive.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-07-24 14:12:05
+
+Description: 打包下载
+*/
+
+package general
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// 支持的打包格式
+const (
+	ArchiveZip   = "zip"    // ZIP 格式
+	ArchiveTarGz = "tar.gz" // tar.gz 格式
+)
+
+// archiveWalkFunc 遍历待打包文件时对每个文件或目录调用的函数
+//
+// 参数：
+//   - archivePath: 文件在压缩包中的路径，目录以 "/" 结尾
+//   - fileInfo: 文件信息
+//   - file: 文件，目录为 nil
+//
+// 返回：
+//   - 错误信息
+type archiveWalkFunc func(archivePath string, fileInfo os.FileInfo, file io.Reader) error
+
+// walkArchive 遍历服务目录中的文件或目录
+//
+// 指向目录的符号链接会被跳过，避免循环引用
+//
+// 参数：
+//   - root: 服务目录
+//   - name: 相对于服务目录的路径
+//   - archivePath: 在压缩包中的路径
+//   - fn: 对每个文件或目录调用的函数
+//
+// 返回：
+//   - 错误信息
+func walkArchive(root http.FileSystem, name, archivePath string, fn archiveWalkFunc) error {
+	file, fileInfo, err := openFile(root, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if !fileInfo.IsDir() {
+		// 跳过设备文件、管道等非常规文件
+		if !fileInfo.Mode().IsRegular() {
+			return nil
+		}
+		return fn(archivePath, fileInfo, file)
+	}
+
+	if archivePath != "" {
+		if err := fn(archivePath+"/", fileInfo, nil); err != nil {
+			return err
+		}
+	}
+	children, err := file.Readdir(-1)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if IsInternalName(child.Name()) {
+			continue
+		}
+		if child.Mode()&os.ModeSymlink != 0 {
+			if isDir, err := isDirectory(root, path.Join(name, child.Name())); err != nil || isDir {
+				continue
+			}
+		}
+		if err := walkArchive(root, path.Join(name, child.Name()), path.Join(archivePath, child.Name()), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsPlainName 判断名称是否是目录中的直接子项名称（不包含路径分隔符，且不是 "." 或 ".."）
+//
+// 参数：
+//   - name: 名称
+//
+// 返回：
+//   - 是否是直接子项名称
+func IsPlainName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// isDirectory 判断服务目录中的路径是否是目录
+//
+// 参数：
+//   - root: 服务目录
+//   - name: 相对于服务目录的路径
+//
+// 返回：
+//   - 是否是目录
+//   - 错误信息
+func isDirectory(root http.FileSystem, name string) (bool, error) {
+	file, fileInfo, err := openFile(root, name)
+	if err != nil {
+		return false, err
+	}
+	file.Close()
+	return fileInfo.IsDir(), nil
+}
+
+// WriteArchive 将服务目录中的文件或目录打包并写入 w，不创建临时文件
+//
+// 参数：
+//   - w: 输出
+//   - format: 打包格式，可选 ArchiveZip、ArchiveTarGz
+//   - root: 服务目录
+//   - dirPath: 基准目录相对于服务目录的路径
+//   - names: 基准目录中要打包的文件或目录名，为空时打包整个基准目录
+//
+// 返回：
+//   - 错误信息
+func WriteArchive(w io.Writer, format string, root http.FileSystem, dirPath string, names []string) error {
+	dirPath = CleanURLPath(dirPath)
+
+	// 待打包的路径及其在压缩包中的路径
+	type archiveItem struct{ name, archivePath string }
+	var items []archiveItem
+	if len(names) == 0 {
+		items = append(items, archiveItem{dirPath, ""})
+	}
+	for _, name := range names {
+		if !IsPlainName(name) || IsInternalName(name) {
+			return fmt.Errorf("Invalid file name: %s", name)
+		}
+		items = append(items, archiveItem{path.Join(dirPath, name), name})
+	}
+
+	switch format {
+	case ArchiveZip:
+		zipWriter := zip.NewWriter(w)
+		for _, item := range items {
+			err := walkArchive(root, item.name, item.archivePath, func(archivePath string, fileInfo os.FileInfo, file io.Reader) error {
+				header, err := zip.FileInfoHeader(fileInfo)
+				if err != nil {
+					return err
+				}
+				header.Name = archivePath
+				if file == nil {
+					_, err = zipWriter.CreateHeader(header)
+					return err
+				}
+				header.Method = zip.Deflate
+				entryWriter, err := zipWriter.CreateHeader(header)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(entryWriter, file)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return zipWriter.Close()
+	case ArchiveTarGz:
+		gzipWriter := gzip.NewWriter(w)
+		tarWriter := tar.NewWriter(gzipWriter)
+		for _, item := range items {
+			err := walkArchive(root, item.name, item.archivePath, func(archivePath string, fileInfo os.FileInfo, file io.Reader) error {
+				header, err := tar.FileInfoHeader(fileInfo, "")
+				if err != nil {
+					return err
+				}
+				header.Name = archivePath
+				if err := tarWriter.WriteHeader(header); err != nil {
+					return err
+				}
+				if file != nil {
+					_, err = io.CopyN(tarWriter, file, header.Size)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := tarWriter.Close(); err != nil {
+			return err
+		}
+		return gzipWriter.Close()
+	default:
+		return fmt.Errorf("Unsupported archive format: %s", format)
+	}
+}
@@ -0,0 +1,181 @@
+/*
+File: define_auth.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-02 11:06:52
+
+Description: HTTP 服务访问认证
+*/
+
+package general
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// 访问认证相关的名称
+const (
+	TokenParam        = "token"          // 访问令牌的查询参数名
+	sessionCookieName = "skynet_session" // 会话 Cookie 名
+	authRealm         = "skynet"         // HTTP Basic 认证域
+)
+
+// GenerateToken 生成随机访问令牌
+//
+// 返回：
+//   - 32 位十六进制字符串形式的访问令牌
+//   - 错误信息
+func GenerateToken() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// authEnabled 判断是否启用了访问认证
+//
+// 返回：
+//   - 是否启用访问认证
+func (fs *FileServer) authEnabled() bool {
+	return fs.options.Password != "" || fs.options.Token != ""
+}
+
+// withAuth 为请求处理器添加访问认证
+//
+// 满足以下任一条件的请求允许访问：
+//   - 携带有效的会话 Cookie
+//   - 查询参数 token 与访问令牌一致，此时设置会话 Cookie，GET 请求重定向到去掉令牌的地址，避免令牌留在浏览器历史中
+//   - HTTP Basic 认证的用户名和密码正确（未设置用户名时接受任意用户名）
+//
+// 参数：
+//   - next: 请求处理器
+//
+// 返回：
+//   - 添加访问认证后的请求处理器
+func (fs *FileServer) withAuth(next http.Handler) http.Handler {
+	if !fs.authEnabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if token := query.Get(TokenParam); fs.options.Token != "" && token != "" && secureEqual(token, fs.options.Token) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookieName,
+				Value:    fs.sessionValue(),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   fs.tlsConfig != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				query.Del(TokenParam)
+				location := *r.URL
+				location.RawQuery = query.Encode()
+				http.Redirect(w, r, location.RequestURI(), http.StatusSeeOther)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cookie, err := r.Cookie(sessionCookieName); err == nil && secureEqual(cookie.Value, fs.sessionValue()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if username, password, ok := r.BasicAuth(); ok && fs.options.Password != "" {
+			if (fs.options.Username == "" || secureEqual(username, fs.options.Username)) && secureEqual(password, fs.options.Password) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if fs.options.Password != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+authRealm+`", charset="UTF-8"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Access token required", http.StatusForbidden)
+	})
+}
+
+// withSameOrigin 拒绝来自其他网站的修改请求，防止跨站请求伪造
+//
+// 浏览器会在跨站请求中自动携带会话 Cookie 和缓存的 Basic 认证信息，未启用访问认证时更是任何请求都能通过，
+// 因此除 GET、HEAD、OPTIONS 外的请求都需要检查来源：
+//   - Sec-Fetch-Site 头存在时，只允许 same-origin 和 none（用户直接发起的请求）
+//   - 否则 Origin 头存在时，其主机必须与请求的 Host 一致
+//   - 两者都不存在时（例如 curl 或 get、put 子命令）不是由浏览器发起的请求，允许访问
+//
+// 参数：
+//   - next: 请求处理器
+//
+// 返回：
+//   - 添加来源检查后的请求处理器
+func (fs *FileServer) withSameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !isSameOrigin(r) {
+			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isSameOrigin 根据 Sec-Fetch-Site 和 Origin 头判断请求是否来自本服务的页面
+//
+// 参数：
+//   - r: 请求
+//
+// 返回：
+//   - 是否来自本服务的页面或不是由浏览器发起
+func isSameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil || originURL.Host == "" {
+		return false // 包括沙箱页面等发出的 "null"
+	}
+	return strings.EqualFold(originURL.Host, r.Host)
+}
+
+// sessionValue 返回会话 Cookie 的值
+//
+// 值由服务启动时生成的随机密钥签名，服务重新创建后之前的会话全部失效
+//
+// 返回：
+//   - 会话 Cookie 的值
+func (fs *FileServer) sessionValue() string {
+	mac := hmac.New(sha256.New, fs.sessionKey)
+	mac.Write([]byte(fs.options.Username + "\x00" + fs.options.Password + "\x00" + fs.options.Token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// secureEqual 以固定时间比较两个字符串，避免通过响应时间猜测密码或令牌
+//
+// 参数：
+//   - a: 字符串
+//   - b: 字符串
+//
+// 返回：
+//   - 是否相等
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,57 @@
+/*
+File: define_auth_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-26 17:02:37
+
+Description: 访问认证和跨站请求检查的测试
+*/
+
+package general
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestWithSameOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		headers map[string]string
+		want    int
+	}{
+		{"no headers", http.MethodPost, "/mkdir", nil, http.StatusOK},
+		{"same origin", http.MethodPost, "/mkdir", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://example.com:8080"}, http.StatusOK},
+		{"user initiated", http.MethodPost, "/mkdir", map[string]string{"Sec-Fetch-Site": "none"}, http.StatusOK},
+		{"cross site", http.MethodPost, "/mkdir", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://evil.example"}, http.StatusForbidden},
+		{"same site", http.MethodPost, "/api/v1/mkdir", map[string]string{"Sec-Fetch-Site": "same-site", "Origin": "http://example.com:9090"}, http.StatusForbidden},
+		{"matching origin", http.MethodPost, "/api/v1/mkdir", map[string]string{"Origin": "http://EXAMPLE.com:8080"}, http.StatusOK},
+		{"other origin", http.MethodPost, "/mkdir", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"other port", http.MethodPost, "/mkdir", map[string]string{"Origin": "http://example.com:9090"}, http.StatusForbidden},
+		{"null origin", http.MethodPost, "/delete", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"cross site upload", http.MethodPost, "/upload", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"cross site chunk", http.MethodPatch, "/upload/chunk/0123456789abcdef0123456789abcdef", map[string]string{"Origin": "http://evil.example"}, http.StatusForbidden},
+		{"cross site read", http.MethodGet, "/api/v1/list", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "http://evil.example"}, http.StatusOK},
+	}
+
+	fileServer := newTestFileServer(t, ServerOptions{Permissions: Permissions{Read: true, Upload: true, Delete: true, Mkdir: true}})
+	for index, test := range tests {
+		body := strings.NewReader(url.Values{"path": {"dir" + string(rune('a'+index))}}.Encode())
+		request := httptest.NewRequest(test.method, "http://example.com:8080"+test.target, body)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Accept", "application/json")
+		for key, value := range test.headers {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		fileServer.Handler().ServeHTTP(recorder, request)
+		if recorder.Code != test.want {
+			t.Errorf("%s: status = %d, want %d: %s", test.name, recorder.Code, test.want, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/*
+File: define_checksum.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-21 11:05:52
+
+Description: 文件 SHA-256 校验和
+*/
+
+package general
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChecksumHeader 上传时由客户端提供的文件校验和请求头，格式为 "sha256=<十六进制>"，也可以只有十六进制部分
+const ChecksumHeader = "X-Checksum"
+
+// ChecksumSHA256 支持的校验和算法，也是列表和查询接口中 checksum 参数的取值
+const ChecksumSHA256 = "sha256"
+
+// ErrChecksumMismatch 上传文件的校验和与客户端提供的不一致
+var ErrChecksumMismatch = errors.New("Checksum mismatch")
+
+// ParseChecksum 解析客户端提供的校验和
+//
+// 参数：
+//   - value: 校验和，格式为 "sha256=<十六进制>"、"sha256:<十六进制>" 或 "<十六进制>"，为空时表示不校验
+//
+// 返回：
+//   - 小写的十六进制校验和，value 为空时为空
+//   - 错误信息
+func ParseChecksum(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if index := strings.IndexAny(value, "=:"); index >= 0 {
+		if algorithm := value[:index]; !strings.EqualFold(algorithm, ChecksumSHA256) {
+			return "", fmt.Errorf("Unsupported checksum algorithm: %s", algorithm)
+		}
+		value = value[index+1:]
+	}
+	value = strings.ToLower(value)
+	if decoded, err := hex.DecodeString(value); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("Invalid SHA-256 checksum: %s", value)
+	}
+	return value, nil
+}
+
+// FileChecksum 计算本地文件的 SHA-256 校验和
+//
+// 参数：
+//   - filePath: 文件路径
+//
+// 返回：
+//   - 小写的十六进制校验和
+//   - 错误信息
+func FileChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return readerChecksum(file)
+}
+
+// readerChecksum 计算数据的 SHA-256 校验和
+//
+// 参数：
+//   - reader: 数据
+//
+// 返回：
+//   - 小写的十六进制校验和
+//   - 错误信息
+func readerChecksum(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checksumEntry 缓存的校验和，文件大小或修改时间变化后失效
+type checksumEntry struct {
+	size    int64     // 文件大小
+	modTime time.Time // 修改时间
+	sum     string    // 校验和
+}
+
+// checksumCache 文件校验和缓存，避免重复读取大文件
+type checksumCache struct {
+	entries map[string]checksumEntry // 键为文件相对于服务目录的路径
+	mutex   sync.Mutex               // 互斥锁，控制对缓存的并发访问
+}
+
+// get 读取缓存的校验和
+//
+// 参数：
+//   - name: 文件相对于服务目录的路径
+//   - fileInfo: 文件信息
+//
+// 返回：
+//   - 校验和
+//   - 是否命中缓存
+func (c *checksumCache) get(name string, fileInfo os.FileInfo) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[name]
+	if !ok || entry.size != fileInfo.Size() || !entry.modTime.Equal(fileInfo.ModTime()) {
+		return "", false
+	}
+	return entry.sum, true
+}
+
+// set 缓存校验和
+//
+// 参数：
+//   - name: 文件相对于服务目录的路径
+//   - fileInfo: 文件信息
+//   - sum: 校验和
+func (c *checksumCache) set(name string, fileInfo os.FileInfo, sum string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]checksumEntry)
+	}
+	c.entries[name] = checksumEntry{size: fileInfo.Size(), modTime: fileInfo.ModTime(), sum: sum}
+}
+
+// fileChecksum 计算服务目录中文件的 SHA-256 校验和，结果会被缓存直到文件发生变化
+//
+// 参数：
+//   - name: 文件相对于服务目录的路径，以 "/" 开头
+//
+// 返回：
+//   - 小写的十六进制校验和
+//   - 错误信息
+func (fs *FileServer) fileChecksum(name string) (string, error) {
+	file, fileInfo, err := openFile(fs.root, name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if fileInfo.IsDir() {
+		return "", ErrIsDir
+	}
+	if sum, ok := fs.checksums.get(name, fileInfo); ok {
+		return sum, nil
+	}
+	sum, err := readerChecksum(file)
+	if err != nil {
+		return "", err
+	}
+	fs.checksums.set(name, fileInfo, sum)
+	return sum, nil
+}
+
+// cacheChecksum 缓存刚上传的文件的校验和，之后查询时无需重新读取
+//
+// 参数：
+//   - relativePath: 文件相对于服务目录的路径
+//   - filePath: 文件的实际路径
+//   - sum: 校验和
+func (fs *FileServer) cacheChecksum(relativePath, filePath, sum string) {
+	if fileInfo, err := os.Stat(filePath); err == nil {
+		fs.checksums.set(CleanURLPath(relativePath), fileInfo, sum)
+	}
+}
+
+// wantsChecksum 解析列表和查询接口中的 checksum 参数
+//
+// 参数：
+//   - value: checksum 参数
+//
+// 返回：
+//   - 是否需要返回校验和
+//   - 错误信息
+func wantsChecksum(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "":
+		return false, nil
+	case ChecksumSHA256:
+		return true, nil
+	default:
+		return false, fmt.Errorf("Unsupported checksum algorithm: %s", value)
+	}
+}
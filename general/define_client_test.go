@@ -0,0 +1,85 @@
+/*
+File: define_client_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-27 09:41:15
+
+Description: 客户端断点续传的测试
+*/
+
+package general
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadResume(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{})
+	server := httptest.NewServer(fileServer.Handler())
+	defer server.Close()
+	client, _, err := NewClient(server.URL, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remotePath := filepath.Join(fileServer.options.Dir, "a.bin")
+	modTime := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	changed := bytes.Repeat([]byte("abcdefghij"), 1200)
+
+	tests := []struct {
+		name       string
+		partial    []byte // 已下载的部分
+		validator  string // 已下载部分对应的远程文件版本，为空时不保存
+		remote     []byte // 远程文件内容
+		remoteTime time.Time
+		resumeAt   int64 // 期望开始下载的位置
+	}{
+		{"unchanged", content[:100], modTime.Format(http.TimeFormat), content, modTime, 100},
+		{"changed", content[:100], modTime.Format(http.TimeFormat), changed, modTime.Add(time.Minute), 0},
+		{"no validator", changed[:100], "", content, modTime, 0},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(remotePath, test.remote, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(remotePath, test.remoteTime, test.remoteTime); err != nil {
+			t.Fatal(err)
+		}
+		localPath := filepath.Join(t.TempDir(), "a.bin")
+		if err := os.WriteFile(localPath+partialSuffix, test.partial, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if test.validator != "" {
+			if err := os.WriteFile(localPath+partialSuffix+validatorSuffix, []byte(test.validator), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		resumeAt := int64(-1)
+		err := client.Download("/a.bin", localPath, func(done, total int64) {
+			if resumeAt < 0 {
+				resumeAt = done
+			}
+		})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if resumeAt != test.resumeAt {
+			t.Errorf("%s: download started at %d, want %d", test.name, resumeAt, test.resumeAt)
+		}
+		if got, _ := os.ReadFile(localPath); !bytes.Equal(got, test.remote) {
+			t.Errorf("%s: downloaded content does not match the remote file", test.name)
+		}
+		if FileExist(localPath+partialSuffix) || FileExist(localPath+partialSuffix+validatorSuffix) {
+			t.Errorf("%s: partial files were not removed", test.name)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/*
+File: define_config.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-07-18 10:21:36
+
+Description: 操作配置文件
+*/
+
+package general
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigFileMode 配置文件的权限，其中可能保存了访问密码，只允许所有者读写
+const ConfigFileMode os.FileMode = 0600
+
+// Config 配置文件结构
+type Config struct {
+	Http   HttpConfig   `toml:"http"`   // HTTP 服务配置
+	Upload UploadConfig `toml:"upload"` // 上传配置
+	Auth   AuthConfig   `toml:"auth"`   // 访问认证配置
+	TLS    TLSConfig    `toml:"tls"`    // HTTPS 配置
+	Log    LogConfig    `toml:"log"`    // 访问日志配置
+}
+
+// HttpConfig HTTP 服务配置
+type HttpConfig struct {
+	Port            int      `toml:"port"`             // 服务端口
+	Dir             string   `toml:"dir"`              // 服务目录，为空时 CLI 使用当前目录，GUI 使用 ~/Downloads
+	Mode            string   `toml:"mode"`             // 服务类型，可选 Download、Upload、All
+	Interface       string   `toml:"interface"`        // 服务绑定的网卡名，"any" 代表 0.0.0.0
+	Bind            string   `toml:"bind"`             // 服务绑定的 IP，非空时优先于 Interface
+	Permissions     []string `toml:"permissions"`      // 操作权限，可选 read、upload、delete、rename、mkdir，为空时由 Mode 决定
+	Advertise       bool     `toml:"advertise"`        // 是否通过 mDNS 在局域网中广播服务，供 discover 子命令和 GUI 发现
+	ThemeDir        string   `toml:"theme_dir"`        // 主题目录，其中的页面模板和 static 目录中的文件覆盖内置文件
+	ShutdownTimeout string   `toml:"shutdown_timeout"` // 关闭服务时等待进行中的传输结束的最长时间，例如 "30s"，超时后强制关闭
+}
+
+// UploadConfig 上传配置
+type UploadConfig struct {
+	MaxMemory    string `toml:"max_memory"`     // 上传表单中 path 等普通字段最多读取的总大小，例如 "10MB"，文件内容直接写入服务目录
+	OnConflict   string `toml:"on_conflict"`    // 上传文件与已有文件同名时的处理策略，可选 rename、overwrite、reject
+	MaxSize      string `toml:"max_size"`       // 单次上传的最大大小，例如 "4GB"，为空或 0 时不限制
+	Quota        string `toml:"quota"`          // 服务目录中所有文件的总大小上限，为空或 0 时不限制
+	MinFreeSpace string `toml:"min_free_space"` // 上传后磁盘至少保留的剩余空间，例如 "100MB"
+}
+
+// AuthConfig 访问认证配置
+type AuthConfig struct {
+	Username string `toml:"username"` // HTTP Basic 认证用户名，为空时接受任意用户名
+	Password string `toml:"password"` // HTTP Basic 认证密码，为空时不启用密码认证
+	Token    bool   `toml:"token"`    // 是否在每次启动时生成随机访问令牌，并将其包含在输出的链接和二维码中
+}
+
+// TLSConfig HTTPS 配置
+type TLSConfig struct {
+	Enable bool   `toml:"enable"` // 是否使用 HTTPS
+	Cert   string `toml:"cert"`   // PEM 格式的证书文件，与 Key 都为空时每次启动生成临时的自签名证书
+	Key    string `toml:"key"`    // PEM 格式的私钥文件
+}
+
+// LogConfig 访问日志配置
+type LogConfig struct {
+	Access     bool   `toml:"access"`      // 是否将访问日志输出到标准输出
+	Format     string `toml:"format"`      // 访问日志格式，可选 text、json
+	File       string `toml:"file"`        // 访问日志文件，为空时不写入文件
+	MaxSize    string `toml:"max_size"`    // 单个日志文件的最大大小，例如 "10MB"，超过后轮转
+	MaxBackups int    `toml:"max_backups"` // 最多保留的旧日志文件数
+}
+
+// DefaultConfig 返回默认配置
+//
+// 返回：
+//   - 默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		Http: HttpConfig{
+			Port:            8080,
+			Dir:             "",
+			Mode:            ModeAll,
+			Interface:       "any",
+			Bind:            "",
+			Permissions:     []string{},
+			Advertise:       true,
+			ThemeDir:        "",
+			ShutdownTimeout: "30s",
+		},
+		Upload: UploadConfig{
+			MaxMemory:    "10MB",
+			OnConflict:   ConflictRename,
+			MaxSize:      "",
+			Quota:        "",
+			MinFreeSpace: "100MB",
+		},
+		Auth: AuthConfig{
+			Username: "",
+			Password: "",
+			Token:    false,
+		},
+		TLS: TLSConfig{
+			Enable: false,
+			Cert:   "",
+			Key:    "",
+		},
+		Log: LogConfig{
+			Access:     true,
+			Format:     LogFormatText,
+			File:       "",
+			MaxSize:    "10MB",
+			MaxBackups: 5,
+		},
+	}
+}
+
+// LoadConfig 读取配置文件，文件中未设置的项使用默认值
+//
+// 参数：
+//   - configFile: 配置文件路径
+//
+// 返回：
+//   - 配置
+//   - 错误信息，配置文件不存在时不视为错误
+func LoadConfig(configFile string) (*Config, error) {
+	config := DefaultConfig()
+	if !FileExist(configFile) {
+		return config, nil
+	}
+	if _, err := toml.DecodeFile(configFile, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// WriteConfig 将配置写入配置文件，所在目录不存在时自动创建，文件权限为 ConfigFileMode
+//
+// 参数：
+//   - configFile: 配置文件路径
+//   - config: 配置
+//
+// 返回：
+//   - 错误信息
+func WriteConfig(configFile string, config *Config) error {
+	if err := os.MkdirAll(filepath.Dir(configFile), os.ModePerm); err != nil {
+		return err
+	}
+
+	var buffer bytes.Buffer
+	if err := toml.NewEncoder(&buffer).Encode(config); err != nil {
+		return err
+	}
+	if err := os.WriteFile(configFile, buffer.Bytes(), ConfigFileMode); err != nil {
+		return err
+	}
+	// 覆盖已有文件时 os.WriteFile 不会修改其权限
+	return os.Chmod(configFile, ConfigFileMode)
+}
+
+// ParseSize 将 "10MB"、"1.5G"、"512k" 或纯数字形式的大小转换为字节数
+//
+// 参数：
+//   - size: 大小字符串，单位不区分大小写，支持 B、K(B)、M(B)、G(B)、T(B)
+//
+// 返回：
+//   - 字节数
+//   - 错误信息
+func ParseSize(size string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(size))
+	if text == "" {
+		return 0, nil
+	}
+
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+		{"B", 1},
+	}
+	multiplier := float64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid size: %s", size)
+	}
+	return int64(value * multiplier), nil
+}
@@ -0,0 +1,806 @@
+/*
+File: define_discovery.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-14 10:32:18
+
+Description: 通过 mDNS/DNS-SD 在局域网中广播和发现 HTTP 文件服务
+*/
+
+package general
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// DiscoveryService 在局域网中广播的 DNS-SD 服务类型
+const DiscoveryService = "_skynet._tcp"
+
+// mDNS 配置
+const (
+	discoveryDomain   = "local."                        // mDNS 域名
+	discoveryServices = "_services._dns-sd._udp.local." // DNS-SD 服务类型枚举名称
+	discoveryTTL      = 120                             // 记录的有效时间（秒）
+	discoveryQUBit    = 1 << 15                         // 问题中的单播响应位，记录中的缓存刷新位
+	discoveryLegacy   = 10                              // 旧式单播查询的响应中记录的最大有效时间（秒）
+	mdnsPacketSize    = 9000                            // mDNS 数据包的最大长度
+	mdnsPort          = 5353                            // mDNS 端口
+	mdnsServicePTR    = DiscoveryService + "." + discoveryDomain
+)
+
+// mdnsGroup mDNS 的 IPv4 组播地址
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// ServiceInfo 在局域网中广播的服务信息
+type ServiceInfo struct {
+	Instance string   // 服务实例名，为空时由主机名和端口生成
+	Hostname string   // 主机名，为空时使用系统主机名
+	Port     int      // 服务端口
+	IPs      []net.IP // 服务绑定的 IPv4 地址，为空时代表所有网卡的地址
+	Mode     string   // 服务类型
+	Path     string   // 服务的访问路径
+	Scheme   string   // 访问协议，http 或 https
+	Auth     string   // 访问认证方式，可选 none、password、token
+}
+
+// Advertiser 通过 mDNS 在局域网中广播服务，响应 DNS-SD 查询
+type Advertiser struct {
+	info       ServiceInfo      // 服务信息
+	service    dnsmessage.Name  // 服务类型名称
+	instance   dnsmessage.Name  // 服务实例名称
+	host       dnsmessage.Name  // SRV 记录指向的主机名称
+	conn       *net.UDPConn     // 组播连接
+	packetConn *ipv4.PacketConn // 用于选择网卡的组播连接
+	interfaces []net.Interface  // 支持组播的网卡
+	writeMutex sync.Mutex       // 互斥锁，控制对组播连接的并发写入
+	closeOnce  sync.Once        // 确保只关闭一次
+	done       chan struct{}    // 广播结束信号
+}
+
+// DiscoveredServer 在局域网中发现的服务
+type DiscoveredServer struct {
+	Instance  string   // 服务实例名
+	Hostname  string   // 主机名
+	Host      string   // 访问服务使用的 IP
+	Port      int      // 服务端口
+	Addresses []net.IP // 服务广播的 IPv4 地址
+	Mode      string   // 服务类型
+	Path      string   // 服务的访问路径
+	Scheme    string   // 访问协议，http 或 https
+	Auth      string   // 访问认证方式，可选 none、password、token
+}
+
+// URL 返回服务的访问地址
+//
+// 返回：
+//   - 访问地址
+func (s DiscoveredServer) URL() string {
+	scheme, servicePath := s.Scheme, s.Path
+	if scheme == "" {
+		scheme = "http"
+	}
+	if !strings.HasPrefix(servicePath, "/") {
+		servicePath = "/" + servicePath
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), servicePath)
+}
+
+// ServiceInfo 返回 HTTP 文件服务在局域网中广播的服务信息，需要在服务启动后调用
+//
+// 返回：
+//   - 服务信息
+//   - 错误信息
+func (fs *FileServer) ServiceInfo() (ServiceInfo, error) {
+	host, portText, err := net.SplitHostPort(fs.Addr())
+	if err != nil {
+		return ServiceInfo{}, err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return ServiceInfo{}, err
+	}
+
+	info := ServiceInfo{
+		Port:   port,
+		Mode:   fs.options.Mode,
+		Path:   "/",
+		Scheme: "http",
+		Auth:   "none",
+	}
+	// 绑定到所有地址时广播各网卡的地址
+	if ip := net.ParseIP(host); ip != nil && !ip.IsUnspecified() {
+		if ip.To4() == nil {
+			return ServiceInfo{}, fmt.Errorf("Unable to advertise IPv6 address: %s", host)
+		}
+		info.IPs = []net.IP{ip.To4()}
+	}
+	if fs.tlsConfig != nil {
+		info.Scheme = "https"
+	}
+	if fs.options.Token != "" {
+		info.Auth = "token"
+	} else if fs.options.Password != "" {
+		info.Auth = "password"
+	}
+	return info, nil
+}
+
+// Advertise 在局域网中广播 HTTP 文件服务，需要在服务启动后调用
+//
+// 返回：
+//   - 广播器，服务停止时应调用其 Close 方法
+//   - 错误信息
+func (fs *FileServer) Advertise() (*Advertiser, error) {
+	info, err := fs.ServiceInfo()
+	if err != nil {
+		return nil, err
+	}
+	return Advertise(info)
+}
+
+// Advertise 通过 mDNS 在局域网中广播服务
+//
+// 参数：
+//   - info: 服务信息
+//
+// 返回：
+//   - 广播器，停止广播时应调用其 Close 方法
+//   - 错误信息
+func Advertise(info ServiceInfo) (*Advertiser, error) {
+	advertiser, err := newAdvertiser(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// 监听 mDNS 组播地址，并在所有支持组播的网卡上加入组播组
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	packetConn := ipv4.NewPacketConn(conn)
+	advertiser.interfaces = multicastInterfaces()
+	for index := range advertiser.interfaces {
+		// 默认网卡已经加入组播组，忽略重复加入的错误
+		packetConn.JoinGroup(&advertiser.interfaces[index], mdnsGroup)
+	}
+	packetConn.SetMulticastTTL(255)
+	packetConn.SetMulticastLoopback(true)
+	// 部分平台不支持获取接收数据包的网卡，此时响应中包含所有地址
+	packetConn.SetControlMessage(ipv4.FlagInterface, true)
+	advertiser.conn = conn
+	advertiser.packetConn = packetConn
+
+	go advertiser.serve()
+	advertiser.announce(discoveryTTL)
+	return advertiser, nil
+}
+
+// newAdvertiser 补全服务信息并生成记录名称，不创建连接
+//
+// 参数：
+//   - info: 服务信息
+//
+// 返回：
+//   - 广播器
+//   - 错误信息
+func newAdvertiser(info ServiceInfo) (*Advertiser, error) {
+	if info.Hostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		info.Hostname = hostname
+	}
+	if info.Instance == "" {
+		info.Instance = fmt.Sprintf("%s-%s-%d", Name, info.Hostname, info.Port)
+	}
+	if info.Path == "" {
+		info.Path = "/"
+	}
+
+	advertiser := &Advertiser{info: info, done: make(chan struct{})}
+	var err error
+	if advertiser.service, err = dnsmessage.NewName(mdnsServicePTR); err != nil {
+		return nil, err
+	}
+	if advertiser.instance, err = dnsmessage.NewName(dnsLabel(info.Instance) + "." + mdnsServicePTR); err != nil {
+		return nil, err
+	}
+	// 每个实例使用独立的主机名称，避免与系统的 mDNS 服务或同一主机上的其他实例冲突
+	if advertiser.host, err = dnsmessage.NewName(dnsLabel(info.Instance) + "." + discoveryDomain); err != nil {
+		return nil, err
+	}
+	return advertiser, nil
+}
+
+// Close 停止广播，并通知局域网中的其他主机服务已下线
+//
+// 返回：
+//   - 错误信息
+func (a *Advertiser) Close() error {
+	var err error
+	a.closeOnce.Do(func() {
+		a.announce(0)
+		err = a.conn.Close()
+		<-a.done
+	})
+	return err
+}
+
+// serve 接收并响应 mDNS 查询，直到连接关闭
+func (a *Advertiser) serve() {
+	defer close(a.done)
+
+	buffer := make([]byte, mdnsPacketSize)
+	for {
+		length, controlMessage, source, err := a.packetConn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		ifIndex := 0
+		if controlMessage != nil {
+			ifIndex = controlMessage.IfIndex
+		}
+		sourceAddr, ok := source.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		a.handleQuery(buffer[:length], ifIndex, sourceAddr)
+	}
+}
+
+// handleQuery 响应 mDNS 查询
+//
+// 源端口不是 5353 的旧式单播查询和设置了单播响应位的查询以单播方式响应，其余以组播方式响应
+//
+// 参数：
+//   - packet: 查询数据包
+//   - ifIndex: 接收数据包的网卡编号，未知时为 0
+//   - source: 查询来源地址
+func (a *Advertiser) handleQuery(packet []byte, ifIndex int, source *net.UDPAddr) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(packet)
+	if err != nil || header.Response || header.OpCode != 0 {
+		return
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return
+	}
+
+	// 来自本机的查询可以访问服务绑定的所有地址（包括回环地址）
+	if isLocalIP(source.IP) {
+		ifIndex = 0
+	}
+	addresses := a.addresses(ifIndex)
+	if len(addresses) == 0 {
+		return
+	}
+
+	legacy := source.Port != mdnsPort
+	unicast := legacy
+	var answers, additionals []dnsmessage.Resource
+	seen := map[string]bool{}
+	add := func(resources *[]dnsmessage.Resource, records ...dnsmessage.Resource) {
+		for _, record := range records {
+			key := record.Header.Name.String() + "/" + record.Header.Type.String() + "/" + record.Body.GoString()
+			if !seen[key] {
+				seen[key] = true
+				*resources = append(*resources, record)
+			}
+		}
+	}
+
+	ttl := uint32(discoveryTTL)
+	if legacy {
+		ttl = discoveryLegacy
+	}
+	for _, question := range questions {
+		name := strings.ToLower(question.Name.String())
+		anyType := question.Type == dnsmessage.TypeALL
+		matched := true
+		switch {
+		case name == strings.ToLower(a.service.String()) && (anyType || question.Type == dnsmessage.TypePTR):
+			add(&answers, a.ptrRecord(a.service, a.instance, ttl))
+			add(&additionals, a.srvRecord(ttl), a.txtRecord(ttl))
+			add(&additionals, a.aRecords(addresses, ttl)...)
+		case name == discoveryServices && (anyType || question.Type == dnsmessage.TypePTR):
+			services, _ := dnsmessage.NewName(discoveryServices)
+			add(&answers, a.ptrRecord(services, a.service, ttl))
+		case name == strings.ToLower(a.instance.String()) && (anyType || question.Type == dnsmessage.TypeSRV || question.Type == dnsmessage.TypeTXT):
+			if anyType || question.Type == dnsmessage.TypeSRV {
+				add(&answers, a.srvRecord(ttl))
+			}
+			if anyType || question.Type == dnsmessage.TypeTXT {
+				add(&answers, a.txtRecord(ttl))
+			}
+			add(&additionals, a.aRecords(addresses, ttl)...)
+		case name == strings.ToLower(a.host.String()) && (anyType || question.Type == dnsmessage.TypeA):
+			add(&answers, a.aRecords(addresses, ttl)...)
+		default:
+			matched = false
+		}
+		if matched && uint16(question.Class)&discoveryQUBit != 0 {
+			unicast = true
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+
+	response := dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: additionals,
+	}
+	// 旧式单播查询的响应需要包含查询 ID 和问题
+	if legacy {
+		response.Header.ID = header.ID
+		response.Questions = questions
+	}
+	packet, err = response.Pack()
+	if err != nil {
+		return
+	}
+	if unicast {
+		a.write(packet, source, ifIndex)
+	} else {
+		a.write(packet, mdnsGroup, ifIndex)
+	}
+}
+
+// announce 在所有网卡上组播服务记录，ttl 为 0 时通知服务已下线
+//
+// 参数：
+//   - ttl: 记录的有效时间（秒）
+func (a *Advertiser) announce(ttl uint32) {
+	for _, netInterface := range a.interfaces {
+		addresses := a.addresses(netInterface.Index)
+		if len(addresses) == 0 {
+			continue
+		}
+		records := []dnsmessage.Resource{a.ptrRecord(a.service, a.instance, ttl), a.srvRecord(ttl), a.txtRecord(ttl)}
+		records = append(records, a.aRecords(addresses, ttl)...)
+		message := dnsmessage.Message{
+			Header:  dnsmessage.Header{Response: true, Authoritative: true},
+			Answers: records,
+		}
+		if packet, err := message.Pack(); err == nil {
+			a.write(packet, mdnsGroup, netInterface.Index)
+		}
+	}
+}
+
+// write 发送 mDNS 数据包
+//
+// 参数：
+//   - packet: 数据包
+//   - destination: 目标地址
+//   - ifIndex: 发送组播数据包使用的网卡编号，为 0 时由系统选择
+func (a *Advertiser) write(packet []byte, destination *net.UDPAddr, ifIndex int) {
+	a.writeMutex.Lock()
+	defer a.writeMutex.Unlock()
+
+	if destination.IP.IsMulticast() && ifIndex > 0 {
+		if netInterface, err := net.InterfaceByIndex(ifIndex); err == nil {
+			a.packetConn.SetMulticastInterface(netInterface)
+		}
+	}
+	a.packetConn.WriteTo(packet, nil, destination)
+}
+
+// addresses 返回在指定网卡上广播的 IPv4 地址
+//
+// 参数：
+//   - ifIndex: 网卡编号，为 0 时返回所有地址
+//
+// 返回：
+//   - IPv4 地址，服务未绑定到该网卡时为空
+func (a *Advertiser) addresses(ifIndex int) []net.IP {
+	var candidates []net.IP
+	if ifIndex > 0 {
+		if netInterface, err := net.InterfaceByIndex(ifIndex); err == nil {
+			candidates = interfaceIPv4s(*netInterface)
+		}
+	} else {
+		for _, netInterface := range a.interfaces {
+			candidates = append(candidates, interfaceIPv4s(netInterface)...)
+		}
+	}
+	if len(a.info.IPs) == 0 {
+		return candidates
+	}
+
+	// 服务绑定到指定地址时只广播该地址
+	var addresses []net.IP
+	for _, ip := range a.info.IPs {
+		for _, candidate := range candidates {
+			if ip.Equal(candidate) {
+				addresses = append(addresses, ip)
+				break
+			}
+		}
+	}
+	if ifIndex == 0 && len(addresses) == 0 {
+		return a.info.IPs
+	}
+	return addresses
+}
+
+// ptrRecord 生成 PTR 记录
+//
+// 参数：
+//   - name: 记录名称
+//   - target: 指向的名称
+//   - ttl: 有效时间（秒）
+//
+// 返回：
+//   - PTR 记录
+func (a *Advertiser) ptrRecord(name, target dnsmessage.Name, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: target},
+	}
+}
+
+// srvRecord 生成服务实例的 SRV 记录
+//
+// 参数：
+//   - ttl: 有效时间（秒）
+//
+// 返回：
+//   - SRV 记录
+func (a *Advertiser) srvRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: a.instance, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET | discoveryQUBit, TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Target: a.host, Port: uint16(a.info.Port)},
+	}
+}
+
+// txtRecord 生成服务实例的 TXT 记录，包含服务类型、主机名、访问路径、协议和认证方式
+//
+// 参数：
+//   - ttl: 有效时间（秒）
+//
+// 返回：
+//   - TXT 记录
+func (a *Advertiser) txtRecord(ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: a.instance, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET | discoveryQUBit, TTL: ttl},
+		Body: &dnsmessage.TXTResource{TXT: []string{
+			"mode=" + a.info.Mode,
+			"hostname=" + a.info.Hostname,
+			"path=" + a.info.Path,
+			"scheme=" + a.info.Scheme,
+			"auth=" + a.info.Auth,
+		}},
+	}
+}
+
+// aRecords 生成主机的 A 记录
+//
+// 参数：
+//   - addresses: IPv4 地址
+//   - ttl: 有效时间（秒）
+//
+// 返回：
+//   - A 记录
+func (a *Advertiser) aRecords(addresses []net.IP, ttl uint32) []dnsmessage.Resource {
+	var records []dnsmessage.Resource
+	for _, ip := range addresses {
+		var address [4]byte
+		copy(address[:], ip.To4())
+		records = append(records, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: a.host, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET | discoveryQUBit, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: address},
+		})
+	}
+	return records
+}
+
+// Discover 在局域网中查找正在运行的 HTTP 文件服务
+//
+// 参数：
+//   - timeout: 等待响应的时间
+//
+// 返回：
+//   - 发现的服务，按实例名排序
+//   - 错误信息
+func Discover(timeout time.Duration) ([]DiscoveredServer, error) {
+	service, err := dnsmessage.NewName(mdnsServicePTR)
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: service, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET | discoveryQUBit}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用临时端口发送旧式单播查询，响应直接发送到该端口
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	packetConn := ipv4.NewPacketConn(conn)
+	packetConn.SetMulticastTTL(255)
+	packetConn.SetMulticastLoopback(true)
+
+	sendQuery := func() error {
+		sent := false
+		for _, netInterface := range multicastInterfaces() {
+			if packetConn.SetMulticastInterface(&netInterface) != nil {
+				continue
+			}
+			if _, err := packetConn.WriteTo(packet, nil, mdnsGroup); err == nil {
+				sent = true
+			}
+		}
+		if !sent {
+			_, err := conn.WriteToUDP(packet, mdnsGroup)
+			return err
+		}
+		return nil
+	}
+	if err := sendQuery(); err != nil {
+		return nil, err
+	}
+
+	collector := newDiscoveryCollector()
+	deadline := time.Now().Add(timeout)
+	resend := time.Now().Add(timeout / 2)
+	buffer := make([]byte, mdnsPacketSize)
+	for {
+		// 等待一半时间后重新查询一次，避免丢包
+		wait := deadline
+		if !resend.IsZero() {
+			wait = resend
+		}
+		conn.SetReadDeadline(wait)
+		length, source, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			var netError net.Error
+			if !errors.As(err, &netError) || !netError.Timeout() {
+				return nil, err
+			}
+			if resend.IsZero() {
+				break
+			}
+			resend = time.Time{}
+			sendQuery()
+			continue
+		}
+		collector.add(buffer[:length], source.IP)
+	}
+	return collector.servers(), nil
+}
+
+// discoveryCollector 汇总 mDNS 响应中的服务记录
+type discoveryCollector struct {
+	instances map[string]bool                   // 服务实例名称
+	srv       map[string]dnsmessage.SRVResource // 服务实例的 SRV 记录
+	txt       map[string][]string               // 服务实例的 TXT 记录
+	addresses map[string][]net.IP               // 主机名称对应的 IPv4 地址
+	sources   map[string]net.IP                 // 服务实例响应的来源地址
+}
+
+// newDiscoveryCollector 创建服务记录汇总器
+//
+// 返回：
+//   - 服务记录汇总器
+func newDiscoveryCollector() *discoveryCollector {
+	return &discoveryCollector{
+		instances: map[string]bool{},
+		srv:       map[string]dnsmessage.SRVResource{},
+		txt:       map[string][]string{},
+		addresses: map[string][]net.IP{},
+		sources:   map[string]net.IP{},
+	}
+}
+
+// add 解析 mDNS 响应并记录其中的服务记录
+//
+// 参数：
+//   - packet: 响应数据包
+//   - source: 响应来源地址
+func (c *discoveryCollector) add(packet []byte, source net.IP) {
+	var message dnsmessage.Message
+	if err := message.Unpack(packet); err != nil || !message.Header.Response {
+		return
+	}
+	records := append(message.Answers, message.Additionals...)
+	for _, record := range records {
+		name := strings.ToLower(record.Header.Name.String())
+		switch body := record.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name != mdnsServicePTR {
+				continue
+			}
+			instance := strings.ToLower(body.PTR.String())
+			if record.Header.TTL == 0 {
+				delete(c.instances, instance) // 服务已下线
+				continue
+			}
+			c.instances[instance] = true
+			c.sources[instance] = source
+		case *dnsmessage.SRVResource:
+			c.srv[name] = *body
+		case *dnsmessage.TXTResource:
+			c.txt[name] = body.TXT
+		case *dnsmessage.AResource:
+			ip := net.IPv4(body.A[0], body.A[1], body.A[2], body.A[3])
+			if !containsIP(c.addresses[name], ip) {
+				c.addresses[name] = append(c.addresses[name], ip)
+			}
+		}
+	}
+}
+
+// servers 返回记录完整的服务
+//
+// 返回：
+//   - 服务，按实例名排序
+func (c *discoveryCollector) servers() []DiscoveredServer {
+	servers := []DiscoveredServer{}
+	for instance := range c.instances {
+		srv, ok := c.srv[instance]
+		if !ok {
+			continue
+		}
+		server := DiscoveredServer{
+			Instance:  strings.TrimSuffix(instance, "."+mdnsServicePTR),
+			Port:      int(srv.Port),
+			Addresses: c.addresses[strings.ToLower(srv.Target.String())],
+			Path:      "/",
+			Scheme:    "http",
+		}
+		for _, item := range c.txt[instance] {
+			key, value, _ := strings.Cut(item, "=")
+			switch strings.ToLower(key) {
+			case "mode":
+				server.Mode = value
+			case "hostname":
+				server.Hostname = value
+			case "path":
+				server.Path = value
+			case "scheme":
+				server.Scheme = value
+			case "auth":
+				server.Auth = value
+			}
+		}
+		// 优先使用响应来源地址，它一定可以访问
+		source := c.sources[instance]
+		switch {
+		case len(server.Addresses) == 0 || containsIP(server.Addresses, source):
+			server.Host = source.String()
+		default:
+			server.Host = server.Addresses[0].String()
+		}
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Instance < servers[j].Instance
+	})
+	return servers
+}
+
+// multicastInterfaces 返回已启用且支持组播的网卡
+//
+// 返回：
+//   - 网卡列表
+func multicastInterfaces() []net.Interface {
+	netInterfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result []net.Interface
+	for _, netInterface := range netInterfaces {
+		if netInterface.Flags&net.FlagUp != 0 && netInterface.Flags&net.FlagMulticast != 0 {
+			result = append(result, netInterface)
+		}
+	}
+	return result
+}
+
+// interfaceIPv4s 返回网卡的 IPv4 地址
+//
+// 参数：
+//   - netInterface: 网卡
+//
+// 返回：
+//   - IPv4 地址
+func interfaceIPv4s(netInterface net.Interface) []net.IP {
+	addrs, err := netInterface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			ips = append(ips, ipNet.IP.To4())
+		}
+	}
+	return ips
+}
+
+// isLocalIP 判断 IP 是否属于本机
+//
+// 参数：
+//   - ip: IP
+//
+// 返回：
+//   - 是否属于本机
+func isLocalIP(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIP 判断 IP 列表中是否包含指定 IP
+//
+// 参数：
+//   - ips: IP 列表
+//   - ip: 要查找的 IP
+//
+// 返回：
+//   - 是否包含
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, item := range ips {
+		if item.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dnsLabel 将文本转换为有效的 DNS 标签，非字母、数字和 "-" 的字符替换为 "-"
+//
+// 参数：
+//   - text: 文本
+//
+// 返回：
+//   - DNS 标签
+func dnsLabel(text string) string {
+	label := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, text)
+	label = strings.Trim(label, "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	if label == "" {
+		label = strings.ToLower(Name)
+	}
+	return label
+}
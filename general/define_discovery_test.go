@@ -0,0 +1,276 @@
+/*
+File: define_discovery_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-27 11:08:33
+
+Description: mDNS 服务广播和发现的测试
+*/
+
+package general
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+// testServiceInfo 测试中广播的服务信息
+var testServiceInfo = ServiceInfo{
+	Instance: "skynet test.instance",
+	Hostname: "test-host",
+	Port:     8080,
+	IPs:      []net.IP{net.IPv4(192, 0, 2, 10).To4()},
+	Mode:     ModeAll,
+	Path:     "/",
+	Scheme:   "https",
+	Auth:     "token",
+}
+
+// newTestAdvertiser 创建只在回环地址上单播响应的广播器，不加入组播组
+//
+// 参数：
+//   - t: 测试
+//   - info: 服务信息
+//
+// 返回：
+//   - 广播器
+//   - 发送查询和接收响应的连接
+func newTestAdvertiser(t *testing.T, info ServiceInfo) (*Advertiser, *net.UDPConn) {
+	t.Helper()
+	advertiser, err := newAdvertiser(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loopback := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	if advertiser.conn, err = net.ListenUDP("udp4", loopback); err != nil {
+		t.Fatal(err)
+	}
+	advertiser.packetConn = ipv4.NewPacketConn(advertiser.conn)
+	client, err := net.ListenUDP("udp4", loopback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		advertiser.conn.Close()
+		client.Close()
+	})
+	return advertiser, client
+}
+
+// queryAdvertiser 以旧式单播查询的方式向广播器发送问题，返回其响应
+//
+// 参数：
+//   - t: 测试
+//   - advertiser: 广播器
+//   - client: 发送查询和接收响应的连接
+//   - questions: 问题
+//
+// 返回：
+//   - 响应数据包，没有响应时为 nil
+func queryAdvertiser(t *testing.T, advertiser *Advertiser, client *net.UDPConn, questions ...dnsmessage.Question) []byte {
+	t.Helper()
+	query := dnsmessage.Message{Header: dnsmessage.Header{ID: 42}, Questions: questions}
+	packet, err := query.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	advertiser.handleQuery(packet, 0, client.LocalAddr().(*net.UDPAddr))
+
+	buffer := make([]byte, mdnsPacketSize)
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	length, _, err := client.ReadFromUDP(buffer)
+	if err != nil {
+		return nil
+	}
+	return buffer[:length]
+}
+
+// question 生成 mDNS 问题
+//
+// 参数：
+//   - t: 测试
+//   - name: 名称
+//   - questionType: 记录类型
+//
+// 返回：
+//   - 问题
+func question(t *testing.T, name string, questionType dnsmessage.Type) dnsmessage.Question {
+	t.Helper()
+	questionName, err := dnsmessage.NewName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dnsmessage.Question{Name: questionName, Type: questionType, Class: dnsmessage.ClassINET}
+}
+
+func TestDiscoveryRoundTrip(t *testing.T) {
+	advertiser, client := newTestAdvertiser(t, testServiceInfo)
+	response := queryAdvertiser(t, advertiser, client, question(t, mdnsServicePTR, dnsmessage.TypePTR))
+	if response == nil {
+		t.Fatal("No response to the PTR query")
+	}
+
+	// 旧式单播查询的响应带有查询 ID 和问题，记录的有效时间被缩短
+	var message dnsmessage.Message
+	if err := message.Unpack(response); err != nil {
+		t.Fatal(err)
+	}
+	if message.Header.ID != 42 || len(message.Questions) != 1 {
+		t.Errorf("Legacy response header = %+v, questions = %d", message.Header, len(message.Questions))
+	}
+	for _, record := range append(message.Answers, message.Additionals...) {
+		if record.Header.TTL != discoveryLegacy {
+			t.Errorf("%s record TTL = %d, want %d", record.Header.Type, record.Header.TTL, discoveryLegacy)
+		}
+	}
+
+	collector := newDiscoveryCollector()
+	source := net.IPv4(127, 0, 0, 1)
+	collector.add(response, source)
+	servers := collector.servers()
+	if len(servers) != 1 {
+		t.Fatalf("Discovered %d servers, want 1: %+v", len(servers), servers)
+	}
+	server := servers[0]
+	want := DiscoveredServer{
+		Instance: "skynet-test-instance",
+		Hostname: testServiceInfo.Hostname,
+		Host:     "192.0.2.10", // 来源地址不在广播的地址中时使用广播的地址
+		Port:     testServiceInfo.Port,
+		Mode:     testServiceInfo.Mode,
+		Path:     testServiceInfo.Path,
+		Scheme:   testServiceInfo.Scheme,
+		Auth:     testServiceInfo.Auth,
+	}
+	if len(server.Addresses) != 1 || !server.Addresses[0].Equal(testServiceInfo.IPs[0]) {
+		t.Errorf("Addresses = %v, want %v", server.Addresses, testServiceInfo.IPs)
+	}
+	server.Addresses = nil
+	if !reflect.DeepEqual(server, want) {
+		t.Errorf("Server = %+v, want %+v", server, want)
+	}
+	if url := server.URL(); url != "https://192.0.2.10:8080/" {
+		t.Errorf("URL = %q", url)
+	}
+
+	// 服务下线时广播有效时间为 0 的 PTR 记录
+	goodbye := dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: []dnsmessage.Resource{advertiser.ptrRecord(advertiser.service, advertiser.instance, 0)},
+	}
+	packet, err := goodbye.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector.add(packet, source)
+	if servers := collector.servers(); len(servers) != 0 {
+		t.Errorf("Server is still listed after goodbye: %+v", servers)
+	}
+}
+
+func TestDiscoveryCollectorSplitResponses(t *testing.T) {
+	info := testServiceInfo
+	info.IPs = []net.IP{net.IPv4(127, 0, 0, 1).To4()}
+	advertiser, client := newTestAdvertiser(t, info)
+	instance := advertiser.instance.String()
+	collector := newDiscoveryCollector()
+	source := net.IPv4(127, 0, 0, 1)
+
+	// 只有 PTR 记录时服务信息不完整
+	ptr := dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{advertiser.ptrRecord(advertiser.service, advertiser.instance, discoveryTTL)},
+	}
+	packet, _ := ptr.Pack()
+	collector.add(packet, source)
+	if servers := collector.servers(); len(servers) != 0 {
+		t.Fatalf("Incomplete server was listed: %+v", servers)
+	}
+
+	// 分别查询 SRV、TXT 和 A 记录后得到完整的服务信息
+	for _, item := range []dnsmessage.Question{
+		question(t, instance, dnsmessage.TypeSRV),
+		question(t, instance, dnsmessage.TypeTXT),
+		question(t, advertiser.host.String(), dnsmessage.TypeA),
+	} {
+		response := queryAdvertiser(t, advertiser, client, item)
+		if response == nil {
+			t.Fatalf("No response to the %s query", item.Type)
+		}
+		collector.add(response, source)
+	}
+	servers := collector.servers()
+	if len(servers) != 1 {
+		t.Fatalf("Discovered %d servers, want 1", len(servers))
+	}
+	if servers[0].Host != "127.0.0.1" || servers[0].Port != info.Port || servers[0].Auth != info.Auth {
+		t.Errorf("Server = %+v", servers[0])
+	}
+
+	// 查询报文、格式错误的数据包不会被当作响应
+	query, _ := (&dnsmessage.Message{Answers: ptr.Answers}).Pack()
+	collector = newDiscoveryCollector()
+	collector.add(query, source)
+	collector.add([]byte{0x00, 0x01, 0x02}, source)
+	if servers := collector.servers(); len(servers) != 0 {
+		t.Errorf("Invalid packets produced servers: %+v", servers)
+	}
+}
+
+func TestHandleQueryIgnoresOtherNames(t *testing.T) {
+	advertiser, client := newTestAdvertiser(t, testServiceInfo)
+	questions := []dnsmessage.Question{
+		question(t, "_http._tcp.local.", dnsmessage.TypePTR),
+		question(t, mdnsServicePTR, dnsmessage.TypeAAAA),
+		question(t, "other-host.local.", dnsmessage.TypeA),
+	}
+	for _, item := range questions {
+		if response := queryAdvertiser(t, advertiser, client, item); response != nil {
+			t.Errorf("Unexpected response to %s %s", item.Name, item.Type)
+		}
+	}
+
+	// 服务类型枚举返回指向 _skynet._tcp 的 PTR 记录
+	response := queryAdvertiser(t, advertiser, client, question(t, discoveryServices, dnsmessage.TypePTR))
+	var message dnsmessage.Message
+	if err := message.Unpack(response); err != nil || len(message.Answers) != 1 {
+		t.Fatalf("Service enumeration response = %+v, %v", message.Answers, err)
+	}
+	if ptr, ok := message.Answers[0].Body.(*dnsmessage.PTRResource); !ok || ptr.PTR.String() != mdnsServicePTR {
+		t.Errorf("Service enumeration answer = %+v", message.Answers[0].Body)
+	}
+}
+
+func TestAdvertiseDiscoverLoopback(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping multicast test in short mode")
+	}
+	if len(multicastInterfaces()) == 0 {
+		t.Skip("No multicast interface available")
+	}
+	info := ServiceInfo{Instance: "skynet-loopback-test", Hostname: "loopback-test", Port: 18080, Mode: ModeDownload, Scheme: "http", Auth: "none"}
+	advertiser, err := Advertise(info)
+	if err != nil {
+		t.Skipf("Multicast is not available: %v", err)
+	}
+	defer advertiser.Close()
+
+	servers, err := Discover(2 * time.Second)
+	if err != nil {
+		t.Skipf("Multicast is not available: %v", err)
+	}
+	for _, server := range servers {
+		if server.Instance == info.Instance {
+			if server.Port != info.Port || server.Mode != info.Mode || server.Hostname != info.Hostname {
+				t.Errorf("Server = %+v", server)
+			}
+			return
+		}
+	}
+	t.Skipf("Advertised service was not discovered, multicast loopback is probably unavailable: %+v", servers)
+}
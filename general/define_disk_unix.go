@@ -0,0 +1,30 @@
+//go:build !windows
+
+/*
+File: define_disk_unix.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-22 15:40:13
+
+Description: 获取磁盘剩余空间（类 Unix 系统）
+*/
+
+package general
+
+import "golang.org/x/sys/unix"
+
+// freeDiskSpace 返回目录所在文件系统中非特权用户可用的剩余空间
+//
+// 参数：
+//   - dir: 目录
+//
+// 返回：
+//   - 剩余字节数
+//   - 错误信息
+func freeDiskSpace(dir string) (int64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
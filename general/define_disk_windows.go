@@ -0,0 +1,34 @@
+//go:build windows
+
+/*
+File: define_disk_windows.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-22 15:40:13
+
+Description: 获取磁盘剩余空间（Windows）
+*/
+
+package general
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace 返回目录所在磁盘中当前用户可用的剩余空间
+//
+// 参数：
+//   - dir: 目录
+//
+// 返回：
+//   - 剩余字节数
+//   - 错误信息
+func freeDiskSpace(dir string) (int64, error) {
+	dirPointer, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var freeBytes, totalBytes, totalFreeBytes uint64
+	if err := windows.GetDiskFreeSpaceEx(dirPointer, &freeBytes, &totalBytes, &totalFreeBytes); err != nil {
+		return 0, err
+	}
+	return int64(freeBytes), nil
+}
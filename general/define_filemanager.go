@@ -10,6 +10,7 @@ Description: 文件管理
 package general
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -44,3 +45,23 @@ func GetAbsPath(filePath string) string {
 		return absPath
 	}
 }
+
+// FormatSize 将字节数转换为可读的大小
+//
+// 参数：
+//   - size: 字节数
+//
+// 返回：
+//   - 可读的大小，例如 "1.5 MB"
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -10,665 +10,585 @@ Description: 管理 HTTP 服务
 package general
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
 	"io"
-	"log"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
 	"sync"
-	"text/template"
-
-	"github.com/gookit/color"
+	"time"
 )
 
-var (
-	HttpServer  *http.Server   // HTTP 服务
-	ServerMutex sync.Mutex     // 互斥锁
-	ServeMux    *http.ServeMux // 路由
+// HTTP 服务支持的服务类型
+const (
+	ModeDownload = "Download" // 下载服务
+	ModeUpload   = "Upload"   // 上传服务
+	ModeAll      = "All"      // 所有服务
 )
 
-// HttpDownloadServerForCLI 启动 HTTP 下载服务
+// ServiceModes HTTP 服务支持的服务类型列表，按 CLI/GUI 显示顺序排列
+var ServiceModes = []string{ModeDownload, ModeUpload, ModeAll}
+
+// ParseServiceMode 将不区分大小写的服务类型名称转换为标准形式
 //
 // 参数：
-//   - address: 服务地址
-//   - port: 服务端口
-//   - dir: 服务目录
-func HttpDownloadServerForCLI(address string, port string, dir string) {
-	method := "Download"
-	// 创建 TCP 监听器
-	listener, err := net.Listen("tcp", address+":"+port)
-	if err != nil {
-		fileName, lineNo := GetCallerInfo()
-		color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
-	} else {
-		// 成功后输出服务信息
-		url := color.Sprintf("http://%s:%v", address, port)
-		color.Info.Tips("Starting HTTP [%s] server at '%s'", SuccessText(method), FgCyanText(dir)) // 服务地址
-		color.Info.Tips("HTTP server url is %s", FgBlueText(url))                                  // URL
-		codeString, err := QrCodeString(url)                                                       // 二维码
-		if err != nil {
-			fileName, lineNo := GetCallerInfo()
-			color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
-		} else {
-			color.Printf("\n%s\n", codeString)
-		}
-		color.Printf("%s\n", CommentText("Press Ctrl+C to stop.")) // 服务停止快捷键
-
-		// 创建请求处理器
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			// 列出文件夹中的所有文件，并提供下载链接
-			files, err := os.ReadDir(dir)
-			if err != nil {
-				color.Fprintf(w, "Error reading download directory: %s", err)
-			}
-
-			templateString := `
-			<!doctype html>
-			<html>
-				<head><title>Download</title></head>
-				<body>
-					<h1>File Download</h1>
-					<hr>
-					<ul>
-						{{range .}}
-							<li><a href="/download/{{.Name}}">{{.Name}}</a></li>
-						{{end}}
-					</ul>
-				</body>
-			</html>
-			`
-			newTemplate, _ := template.New(strings.ToLower(method)).Parse(templateString)
-			newTemplate.Execute(w, files)
-		})
-		http.Handle("/download/", http.StripPrefix("/download/", http.FileServer(http.Dir(dir))))
-
-		// 启动服务器
-		if err := http.Serve(listener, nil); err == http.ErrServerClosed {
-			color.Printf("HTTP Server closed\n")
-		} else if err != nil {
-			fileName, lineNo := GetCallerInfo()
-			color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+//   - mode: 服务类型名称，例如 "download"
+//
+// 返回：
+//   - 标准服务类型名称，例如 "Download"
+//   - 错误信息
+func ParseServiceMode(mode string) (string, error) {
+	for _, serviceMode := range ServiceModes {
+		if strings.EqualFold(serviceMode, mode) {
+			return serviceMode, nil
 		}
 	}
+	return "", fmt.Errorf("Unsupported service mode: %s", mode)
 }
 
-// HttpUploadServerForCLI 启动 HTTP 上传服务
+// ServerOptions HTTP 文件服务配置
+type ServerOptions struct {
+	Mode        string       // 服务类型，可选 ModeDownload、ModeUpload、ModeAll
+	Permissions Permissions  // 操作权限，未开启任何权限时使用服务类型对应的默认权限
+	Address     string       // 服务地址
+	Port        string       // 服务端口
+	Dir         string       // 服务目录
+	MaxMemory   int64        // 上传表单中 path 等普通字段最多读取的总字节数，文件内容不受限制，直接写入服务目录
+	Limits      UploadLimits // 上传大小、存储配额和磁盘剩余空间限制
+	OnConflict  string       // 上传文件与已有文件同名时的处理策略，可选 ConflictRename、ConflictOverwrite、ConflictReject
+	Username    string       // HTTP Basic 认证用户名，为空时接受任意用户名
+	Password    string       // HTTP Basic 认证密码，为空时不启用密码认证
+	Token       string       // 访问令牌，非空时可通过 ShareURL 返回的链接访问服务
+	TLS         bool         // 是否使用 HTTPS
+	CertFile    string       // PEM 格式的证书文件，与 KeyFile 都为空时生成临时的自签名证书
+	KeyFile     string       // PEM 格式的私钥文件
+	ThemeDir    string       // 主题目录，其中的页面模板和 static 目录中的文件覆盖内置文件，为空时使用内置页面
+	AccessLog   io.Writer    // 访问日志输出，为 nil 时不记录访问日志
+	LogFormat   string       // 访问日志格式，可选 LogFormatText、LogFormatJSON，默认为 LogFormatText
+}
+
+// FileServer HTTP 文件服务
+//
+// 每个 FileServer 拥有独立的路由，同一进程中可以同时运行多个实例
+type FileServer struct {
+	options    ServerOptions                 // 服务配置
+	root       http.FileSystem               // 服务目录
+	mux        *http.ServeMux                // 路由
+	handler    http.Handler                  // 添加访问认证后的请求处理器
+	sessionKey []byte                        // 会话 Cookie 签名密钥
+	tlsConfig  *tls.Config                   // HTTPS 配置，未启用 HTTPS 时为 nil
+	pages      map[string]*template.Template // 页面模板
+	static     http.Handler                  // 静态资源处理器
+	server     *http.Server                  // HTTP 服务
+	listener   net.Listener                  // TCP 监听器
+	done       chan struct{}                 // 服务结束信号
+	err        error                         // 服务结束原因
+	chunkLocks chunkLocks                    // 分块上传会话锁
+	transfers  transferTracker               // 文件传输统计
+	checksums  checksumCache                 // 文件校验和缓存
+	usage      diskUsage                     // 服务目录已用空间
+	background sync.WaitGroup                // 随服务运行的后台任务，服务结束时等待其退出
+	mutex      sync.Mutex                    // 互斥锁，控制对服务状态的并发访问
+}
+
+// 默认配置
+const (
+	defaultMaxMemory int64 = 10 << 20 // 上传表单中普通字段默认最多读取 10MB
+)
+
+// NewFileServer 创建 HTTP 文件服务
 //
 // 参数：
-//   - address: 服务地址
-//   - port: 服务端口
-//   - dir: 服务目录
-func HttpUploadServerForCLI(address string, port string, dir string) {
-	method := "Upload"
-	// 创建 TCP 监听器
-	listener, err := net.Listen("tcp", address+":"+port)
+//   - options: 服务配置
+//
+// 返回：
+//   - HTTP 文件服务
+//   - 错误信息
+func NewFileServer(options ServerOptions) (*FileServer, error) {
+	switch options.Mode {
+	case ModeDownload, ModeUpload, ModeAll:
+	default:
+		return nil, fmt.Errorf("Unsupported service mode: %s", options.Mode)
+	}
+	if options.Dir == "" {
+		return nil, errors.New("Service directory is not specified")
+	}
+	if options.Permissions == (Permissions{}) {
+		options.Permissions = ModePermissions(options.Mode)
+	}
+	if options.MaxMemory <= 0 {
+		options.MaxMemory = defaultMaxMemory
+	}
+	if options.OnConflict == "" {
+		options.OnConflict = ConflictRename
+	}
+	onConflict, err := ParseConflictPolicy(options.OnConflict)
 	if err != nil {
-		fileName, lineNo := GetCallerInfo()
-		color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
-	} else {
-		// 成功后输出服务信息
-		url := color.Sprintf("http://%s:%v", address, port)
-		color.Info.Tips("Starting HTTP [%s] server at '%s'", SuccessText(method), FgCyanText(dir)) // 服务地址
-		color.Info.Tips("HTTP server url is %s", FgBlueText(url))                                  // URL
-		codeString, err := QrCodeString(url)                                                       // 二维码
-		if err != nil {
-			fileName, lineNo := GetCallerInfo()
-			color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
-		} else {
-			color.Printf("\n%s\n", codeString)
-		}
-		color.Printf("%s\n", CommentText("Press Ctrl+C to stop.")) // 服务停止快捷键
-
-		// 在 DefaultServeMux 中注册给定模式的处理函数
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodPost {
-				// 解析表单
-				if err := r.ParseMultipartForm(10 << 20); err != nil { // 限制上传文件大小
-					http.Error(w, err.Error(), http.StatusBadRequest)
-					return
-				}
-
-				file, handler, err := r.FormFile("file")
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusBadRequest)
-					return
-				}
-				defer file.Close()
-
-				// 创建文件保存到 uploads 文件夹
-				targetFile, err := os.Create(filepath.Join(dir, handler.Filename))
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				defer targetFile.Close()
-
-				// 将上传文件内容复制到新文件
-				if _, err = io.Copy(targetFile, file); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				// 返回包含 JavaScript 的响应以显示弹窗通知
-				js := color.Sprintf(`
-				<script>
-					alert("File uploaded successfully\n%s");
-					window.location.href = '/upload';
-				</script>
-				`, handler.Filename)
-				color.Fprintln(w, js)
-			} else {
-				// 显示文件上传表单
-				templateString := `
-				<!doctype html>
-				<html>
-					<head><title>Upload</title></head>
-					<body>
-						<h1>File Upload</h1>
-						<hr><br>
-						<form action="/upload" method="post" enctype="multipart/form-data">
-							<input type="file" name="file">
-							<input type="submit" value="Upload">
-						</form>
-					</body>
-				</html>
-				`
-				newTemplate, _ := template.New(strings.ToLower(method)).Parse(templateString)
-				newTemplate.Execute(w, nil)
-			}
-		})
+		return nil, err
+	}
+	options.OnConflict = onConflict
+	if options.LogFormat == "" {
+		options.LogFormat = LogFormatText
+	}
+	if options.LogFormat, err = ParseLogFormat(options.LogFormat); err != nil {
+		return nil, err
+	}
 
-		// 启动服务器
-		if err := http.Serve(listener, nil); err == http.ErrServerClosed {
-			color.Printf("HTTP Server closed\n")
-		} else if err != nil {
-			fileName, lineNo := GetCallerInfo()
-			color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
-		}
+	sessionKey := make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, err
 	}
-}
 
-// HttpAllServerForCLI 启动所有 HTTP 服务
-//
-// 参数：
-//   - address: 服务地址
-//   - port: 服务端口
-//   - dir: 服务目录
-func HttpAllServerForCLI(address string, port string, dir string) {
-	method := "All"
-	// 创建 TCP 监听器
-	listener, err := net.Listen("tcp", address+":"+port)
+	pages, static, err := loadTheme(options.ThemeDir)
 	if err != nil {
-		fileName, lineNo := GetCallerInfo()
-		color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
-	} else {
-		// 成功后输出服务信息
-		url := color.Sprintf("http://%s:%v", address, port)
-		color.Info.Tips("Starting HTTP [%s] server at '%s'", SuccessText(method), FgCyanText(dir)) // 服务地址
-		color.Info.Tips("HTTP server url is %s", FgBlueText(url))                                  // URL
-		codeString, err := QrCodeString(url)                                                       // 二维码
-		if err != nil {
-			fileName, lineNo := GetCallerInfo()
-			color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
-		} else {
-			color.Printf("\n%s\n", codeString)
-		}
-		color.Printf("%s\n", CommentText("Press Ctrl+C to stop.")) // 服务停止快捷键
-
-		// 在 DefaultServeMux 中注册给定模式的处理函数
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			// 根路径上显示一个链接到 /upload 页面
-			templateString := `
-			<!doctype html>
-			<html>
-				<head><title>File Service</title></head>
-				<body>
-					<h1>Welcome to the File Service</h1>
-					<hr>
-					<a href="/upload">File Upload</a><br>
-					<a href="/download">File Download</a>
-				</body>
-			</html>
-			`
-			newTemplate, _ := template.New("root").Parse(templateString)
-			newTemplate.Execute(w, nil)
-		})
-		// 启动 Upload 服务器
-		http.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == http.MethodPost {
-				// 解析表单
-				if err := r.ParseMultipartForm(10 << 20); err != nil { // 限制上传文件大小
-					http.Error(w, err.Error(), http.StatusBadRequest)
-					return
-				}
-
-				file, handler, err := r.FormFile("file")
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusBadRequest)
-					return
-				}
-				defer file.Close()
-
-				// 创建文件保存到 uploads 文件夹
-				targetFile, err := os.Create(filepath.Join(dir, handler.Filename))
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				defer targetFile.Close()
-
-				// 将上传文件内容复制到新文件
-				if _, err = io.Copy(targetFile, file); err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				// 返回包含 JavaScript 的响应以显示弹窗通知
-				js := color.Sprintf(`
-				<script>
-					alert("File uploaded successfully\n%s");
-					window.location.href = '/upload';
-				</script>
-				`, handler.Filename)
-				color.Fprintln(w, js)
-			} else {
-				// 显示文件上传表单
-				templateString := `
-				<!doctype html>
-				<html>
-					<head><title>Upload</title></head>
-					<body>
-						<h1>File Upload</h1>
-						<a href="/">Back to Main Page</a>
-						<a href="/download">Go to Download Page</a>
-						<br><br>
-						<form action="/upload" method="post" enctype="multipart/form-data">
-							<input type="file" name="file">
-							<input type="submit" value="Upload">
-						</form>
-					</body>
-				</html>
-			`
-				newTemplate, _ := template.New("upload").Parse(templateString)
-				newTemplate.Execute(w, nil)
-			}
-		})
-		// 启动 Download 服务器
-		http.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
-			// 列出文件夹中的所有文件，并提供下载链接
-			files, err := os.ReadDir(dir)
-			if err != nil {
-				color.Fprintf(w, "Error reading download directory: %s", err)
-			}
+		return nil, err
+	}
 
-			templateString := `
-			<!doctype html>
-			<html>
-				<head><title>Download</title></head>
-				<body>
-					<h1>File Download</h1>
-					<a href="/">Back to Main Page</a>
-					<a href="/upload">Go to Upload Page</a>
-					<hr>
-					<ul>
-						{{range .}}
-							<li><a href="/download/{{.Name}}">{{.Name}}</a></li>
-						{{end}}
-					</ul>
-				</body>
-			</html>
-			`
-			newTemplate, _ := template.New("download").Parse(templateString)
-			newTemplate.Execute(w, files)
-		})
-		http.Handle("/download/", http.StripPrefix("/download/", http.FileServer(http.Dir(dir))))
-
-		// 启动服务器
-		if err := http.Serve(listener, nil); err == http.ErrServerClosed {
-			color.Printf("HTTP Server closed\n")
-		} else if err != nil {
-			fileName, lineNo := GetCallerInfo()
-			color.Printf("%s %s %s\n", DangerText(ErrorInfoFlag), SecondaryText("[", fileName, ":", lineNo+1, "]"), err)
+	fileServer := &FileServer{options: options, root: http.Dir(options.Dir), sessionKey: sessionKey, pages: pages, static: static}
+	if options.TLS {
+		certificate, err := LoadCertificate(options.CertFile, options.KeyFile, options.Address)
+		if err != nil {
+			return nil, err
 		}
+		fileServer.tlsConfig = &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
 	}
+	fileServer.mux = fileServer.routes()
+	fileServer.handler = fileServer.withAccessLog(fileServer.withSameOrigin(fileServer.withAuth(fileServer.mux)))
+	return fileServer, nil
 }
 
-// HttpDownloadServerForGUI 启动 HTTP 下载服务
+// routes 注册路由，每个路由在处理请求前检查对应的权限
+//
+// 返回：
+//   - 路由
+func (fs *FileServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", fs.handleIndexPage)
+	mux.Handle("/static/", fs.static)
+	mux.HandleFunc("/download", fs.require(PermRead, fs.handleDownload))
+	mux.HandleFunc("/download/", fs.require(PermRead, fs.handleDownload))
+	mux.HandleFunc("/archive/", fs.require(PermRead, fs.handleArchive))
+	mux.HandleFunc("/upload", fs.require(PermUpload, fs.handleUpload))
+	mux.HandleFunc("/upload/chunk", fs.require(PermUpload, fs.handleChunkUpload))
+	mux.HandleFunc("/upload/chunk/", fs.require(PermUpload, fs.handleChunkUpload))
+	mux.HandleFunc("/delete", fs.require(PermDelete, fs.handleDelete))
+	mux.HandleFunc("/rename", fs.require(PermRename, fs.handleRename))
+	mux.HandleFunc("/move", fs.require(PermRename, fs.handleMove))
+	mux.HandleFunc("/mkdir", fs.require(PermMkdir, fs.handleMkdir))
+	fs.apiRoutes(mux)
+	return mux
+}
+
+// Handler 返回 HTTP 文件服务的请求处理器，可用于不监听端口的场景（例如嵌入其他服务或测试）
+//
+// 返回：
+//   - 请求处理器
+func (fs *FileServer) Handler() http.Handler {
+	return fs.handler
+}
+
+// Options 返回 HTTP 文件服务配置
+//
+// 返回：
+//   - 服务配置
+func (fs *FileServer) Options() ServerOptions {
+	return fs.options
+}
+
+// Start 启动 HTTP 文件服务，监听成功后立即返回，服务在后台运行
+//
+// ctx 结束时服务会被关闭
 //
 // 参数：
-//   - address: 服务地址
-//   - port: 服务端口
-//   - dir: 服务目录
+//   - ctx: 上下文
 //
 // 返回：
-//   - HTTP 服务器对象
 //   - 错误信息
-func HttpDownloadServerForGUI(address string, port string, dir string) (*http.Server, error) {
+func (fs *FileServer) Start(ctx context.Context) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if fs.server != nil {
+		return errors.New("HTTP server is already running")
+	}
+
 	// 服务启动目录不存在则创建
-	if !FileExist(dir) {
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-			return nil, err
+	if !FileExist(fs.options.Dir) {
+		if err := os.MkdirAll(fs.options.Dir, os.ModePerm); err != nil {
+			return err
 		}
 	}
 
-	// 加锁，控制对 HTTP 服务器和路由注册的并发访问
-	// 确保只有一个 goroutine 能够启动 HTTP 服务器和注册路由，防止多次重复注册相同的路由
-	ServerMutex.Lock()
-	defer ServerMutex.Unlock()
+	// 清理被放弃的分块上传
+	fs.removeStaleChunkSessions(chunkSessionMaxAge)
 
-	// 创建路由
-	ServeMux = http.NewServeMux()
-	// 注册给定模式的处理函数
-	ServeMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// 列出文件夹中的所有文件，并提供下载链接
-		files, err := os.ReadDir(dir)
-		if err != nil {
-			color.Fprintf(w, "Error reading download directory: %s", err)
-		}
-
-		templateString := `
-		<!doctype html>
-		<html>
-			<head><title>Download</title></head>
-			<body>
-				<h1>File Download</h1>
-				<hr>
-				<ul>
-					{{range .}}
-						<li><a href="/download/{{.Name}}">{{.Name}}</a></li>
-					{{end}}
-				</ul>
-			</body>
-		</html>
-		`
-		newTemplate, _ := template.New("download").Parse(templateString)
-		newTemplate.Execute(w, files)
-	})
-	// 注册给定模式的处理程序
-	ServeMux.Handle("/download/", http.StripPrefix("/download/", http.FileServer(http.Dir(dir))))
+	// 创建 TCP 监听器
+	listener, err := net.Listen("tcp", net.JoinHostPort(fs.options.Address, fs.options.Port))
+	if err != nil {
+		return err
+	}
+	if fs.tlsConfig != nil {
+		listener = tls.NewListener(listener, fs.tlsConfig)
+	}
 
 	// 创建 HTTP 服务器
-	HttpServer = &http.Server{
-		Handler: ServeMux, // 调用的处理程序
+	server := &http.Server{
+		Handler: fs.handler, // 调用的处理程序
 	}
-
-	// 创建 TCP 监听器
-	listener, err := net.Listen("tcp", address+":"+port)
-	if err != nil {
-		return nil, err
-	} else {
-		// 启动 HTTP 服务器
-		go func() {
-			if err := HttpServer.Serve(listener); err == http.ErrServerClosed {
-				log.Println(FgYellowText("HTTP Server closed"))
-				ServeMux = nil
-				HttpServer = nil
-			} else if err != nil {
-				log.Printf("%s\n", DangerText("HTTP server error: ", err))
-				ServeMux = nil
-				HttpServer = nil
+	done := make(chan struct{})
+
+	fs.server = server
+	fs.listener = listener
+	fs.done = done
+	fs.err = nil
+
+	// 启动 HTTP 服务器
+	go func() {
+		err := server.Serve(listener)
+		fs.mutex.Lock()
+		if err != http.ErrServerClosed {
+			fs.err = err
+		}
+		fs.server = nil
+		fs.mutex.Unlock()
+		close(done)
+	}()
+
+	// 定期清理被放弃的分块上传，服务结束时停止
+	fs.background.Add(1)
+	go func() {
+		defer fs.background.Done()
+		ticker := time.NewTicker(chunkSessionCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fs.removeStaleChunkSessions(chunkSessionMaxAge)
+			case <-done:
+				return
 			}
-		}()
+		}
+	}()
+
+	// 上下文结束时关闭服务
+	go func() {
+		select {
+		case <-ctx.Done():
+			server.Shutdown(context.Background())
+		case <-done:
+		}
+	}()
+
+	return nil
+}
+
+// Wait 阻塞直到 HTTP 文件服务结束
+//
+// 返回：
+//   - 服务异常结束的错误信息，正常关闭时为 nil
+func (fs *FileServer) Wait() error {
+	fs.mutex.Lock()
+	done := fs.done
+	fs.mutex.Unlock()
+
+	if done == nil {
+		return nil
 	}
+	<-done
 
-	return HttpServer, nil
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	return fs.err
 }
 
-// HttpUploadServerForGUI 启动 HTTP 上传服务
+// Shutdown 关闭 HTTP 文件服务
+//
+// 停止接受新的连接并等待进行中的传输结束，ctx 结束时强制关闭所有连接，
+// 被中断的上传会删除不完整的文件（分块上传保留已接收的部分用于续传）
 //
 // 参数：
-//   - address: 服务地址
-//   - port: 服务端口
-//   - dir: 服务目录
+//   - ctx: 上下文，用于控制等待活动连接结束的时间
 //
 // 返回：
-//   - HTTP 服务器对象
-//   - 错误信息
-func HttpUploadServerForGUI(address string, port string, dir string) (*http.Server, error) {
-	// 服务启动目录不存在则创建
-	if !FileExist(dir) {
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-			return nil, err
-		}
+//   - 错误信息，ctx 结束导致强制关闭时为 ctx 的错误
+func (fs *FileServer) Shutdown(ctx context.Context) error {
+	fs.mutex.Lock()
+	server, done := fs.server, fs.done
+	fs.mutex.Unlock()
+
+	if server == nil {
+		return nil
 	}
+	err := server.Shutdown(ctx)
+	if err != nil {
+		server.Close()
+	}
+	<-done
+	// 强制关闭连接后处理器仍可能在清理，等待其结束
+	fs.transfers.wait()
+	fs.background.Wait()
+	return err
+}
 
-	// 创建路由
-	ServeMux = http.NewServeMux()
-	// 注册给定模式的处理函数
-	ServeMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			// 解析表单
-			if err := r.ParseMultipartForm(100 << 20); err != nil { // 限制内存最多存储100MB，超出的部分保存到磁盘
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			file, handler, err := r.FormFile("file") // 获取上传文件
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			defer file.Close()
-
-			// 创建文件保存到服务目录
-			targetFile, err := os.Create(filepath.Join(dir, handler.Filename))
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			defer targetFile.Close()
-
-			// 将上传文件内容复制到新文件
-			if _, err = io.Copy(targetFile, file); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			// JS 显示弹窗通知
-			js := color.Sprintf(`
-			<script>
-				alert("File uploaded successfully\n%s");
-				window.location.href = '/upload';
-			</script>
-			`, handler.Filename)
-			color.Fprintln(w, js)
-		} else {
-			// 显示文件上传表单
-			templateString := `
-			<!doctype html>
-			<html>
-				<head><title>Upload</title></head>
-				<body>
-					<h1>File Upload</h1>
-					<hr><br>
-					<form action="/upload" method="post" enctype="multipart/form-data">
-						<input type="file" name="file">
-						<input type="submit" value="Upload">
-					</form>
-				</body>
-			</html>
-			`
-			newTemplate, _ := template.New("upload").Parse(templateString)
-			newTemplate.Execute(w, nil)
+// Addr 返回 HTTP 文件服务的监听地址
+//
+// 服务启动后返回实际监听的地址（例如端口为 0 时由系统分配的端口），否则返回配置的地址
+//
+// 返回：
+//   - 监听地址
+func (fs *FileServer) Addr() string {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	port := fs.options.Port
+	if fs.listener != nil {
+		// 使用配置的地址而非监听器地址，避免 0.0.0.0 被显示为 [::]
+		if _, listenPort, err := net.SplitHostPort(fs.listener.Addr().String()); err == nil {
+			port = listenPort
 		}
-	})
+	}
+	return net.JoinHostPort(fs.options.Address, port)
+}
 
-	// 创建 HTTP 服务器
-	HttpServer = &http.Server{
-		Handler: ServeMux, // 调用的处理程序
+// URL 返回 HTTP 文件服务的访问地址
+//
+// 返回：
+//   - 访问地址
+func (fs *FileServer) URL() string {
+	if fs.tlsConfig != nil {
+		return fmt.Sprintf("https://%s", fs.Addr())
 	}
+	return fmt.Sprintf("http://%s", fs.Addr())
+}
 
-	// 创建 TCP 监听器
-	listener, err := net.Listen("tcp", address+":"+port)
-	if err != nil {
-		return nil, err
-	} else {
-		// 启动 HTTP 服务器
-		go func() {
-			if err := HttpServer.Serve(listener); err == http.ErrServerClosed {
-				log.Println(FgYellowText("HTTP Server closed"))
-				ServeMux = nil
-				HttpServer = nil
-			} else if err != nil {
-				log.Printf("%s\n", DangerText("HTTP server error: ", err))
-				ServeMux = nil
-				HttpServer = nil
-			}
-		}()
+// Fingerprint 返回 HTTPS 证书的 SHA-256 指纹，供用户核对证书
+//
+// 返回：
+//   - 证书指纹，未启用 HTTPS 时为空字符串
+func (fs *FileServer) Fingerprint() string {
+	if fs.tlsConfig == nil {
+		return ""
 	}
+	return CertificateFingerprint(fs.tlsConfig.Certificates[0])
+}
 
-	return HttpServer, nil
+// ShareURL 返回用于分享的访问地址，设置了访问令牌时地址中包含令牌
+//
+// 返回：
+//   - 分享地址
+func (fs *FileServer) ShareURL() string {
+	if fs.options.Token == "" {
+		return fs.URL() + "/"
+	}
+	return fmt.Sprintf("%s/?%s=%s", fs.URL(), TokenParam, url.QueryEscape(fs.options.Token))
 }
 
-// HttpAllServerForGUI 启动 HTTP 所有服务
+// handleIndexPage 处理对服务根路径的请求
+//
+// 同时拥有浏览和上传权限时显示包含上传和下载页面链接的首页，否则直接显示下载或上传页面
 //
 // 参数：
-//   - address: 服务地址
-//   - port: 服务端口
-//   - dir: 服务目录
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleIndexPage(w http.ResponseWriter, r *http.Request) {
+	permissions := fs.options.Permissions
+	switch {
+	case permissions.Read && permissions.Upload:
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fs.render(w, "index", map[string]interface{}{
+			"Navigation": fs.navigation(),
+		})
+	case permissions.Read:
+		fs.handleDownload(w, r)
+	case permissions.Upload:
+		fs.handleUpload(w, r)
+	default:
+		http.Error(w, "Permission denied", http.StatusForbidden)
+	}
+}
+
+// navigation 判断页面是否显示上传和下载页面之间的导航链接
 //
 // 返回：
-//   - HTTP 服务器对象
-//   - 错误信息
-func HttpAllServerForGUI(address string, port string, dir string) (*http.Server, error) {
-	// 服务启动目录不存在则创建
-	if !FileExist(dir) {
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-			return nil, err
+//   - 同时拥有浏览和上传权限时为 true
+func (fs *FileServer) navigation() bool {
+	return fs.options.Permissions.Read && fs.options.Permissions.Upload
+}
+
+// handleDownload 提供文件下载，请求的路径是目录时列出其中的文件和子目录
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleDownload(w http.ResponseWriter, r *http.Request) {
+	name := CleanURLPath(strings.TrimPrefix(r.URL.Path, "/download"))
+	if hasInternalSegment(name) {
+		http.NotFound(w, r)
+		return
+	}
+	file, fileInfo, err := openFile(fs.root, name)
+	if err != nil {
+		httpFileError(w, err)
+		return
+	}
+	defer file.Close()
+
+	// 请求的是文件，直接下载（支持 Range 请求）
+	if !fileInfo.IsDir() {
+		defer fs.transfers.begin()()
+		recorder := &statusRecorder{ResponseWriter: w}
+		http.ServeContent(recorder, r, fileInfo.Name(), fileInfo.ModTime(), file)
+		// 只统计实际发送文件内容的请求，客户端断开或服务被强制关闭时请求的上下文会被取消
+		if status := recorder.status(); r.Method != http.MethodHead && (status == http.StatusOK || status == http.StatusPartialContent) {
+			fs.transfers.addDownload(recorder.bytes, r.Context().Err() == nil)
 		}
+		return
 	}
 
-	// 创建路由
-	ServeMux = http.NewServeMux()
-	// 注册给定模式的处理函数
-	ServeMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// 根路径上显示一个链接到 /upload 页面
-		templateString := `
-		<!doctype html>
-		<html>
-			<head><title>File Service</title></head>
-			<body>
-				<h1>Welcome to the File Service</h1>
-				<hr>
-				<a href="/upload-service">File Upload</a><br>
-				<a href="/download-service">File Download</a>
-			</body>
-		</html>
-		`
-		newTemplate, _ := template.New("root").Parse(templateString)
-		newTemplate.Execute(w, nil)
-	})
-	ServeMux.HandleFunc("/upload-service", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			// 解析表单
-			if err := r.ParseMultipartForm(100 << 20); err != nil { // 限制内存最多存储100MB，超出的部分保存到磁盘
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-
-			file, handler, err := r.FormFile("file") // 获取上传文件
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
-				return
-			}
-			defer file.Close()
+	// 请求的是目录，确保路径以 "/" 结尾，否则相对链接会出错
+	if r.URL.Path != "/" && !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, EscapeURLPath(r.URL.Path+"/"), http.StatusMovedPermanently)
+		return
+	}
 
-			// 创建文件保存到服务目录
-			targetFile, err := os.Create(filepath.Join(dir, handler.Filename))
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			defer targetFile.Close()
+	query := r.URL.Query()
+	listing, err := ReadListing(fs.root, name, "/download", query.Get("sort"), query.Get("order"))
+	if err != nil {
+		httpFileError(w, err)
+		return
+	}
+	listing.ArchiveHref = EscapeURLPath("/archive" + listing.Path)
+	checksums := strings.EqualFold(query.Get("checksum"), ChecksumSHA256)
+	for index, entry := range listing.Entries {
+		if entry.IsDir {
+			listing.Entries[index].ArchiveHref = EscapeURLPath("/archive" + entry.Path)
+		} else if checksums {
+			// 计算失败（例如文件已被删除）时不显示
+			listing.Entries[index].SHA256, _ = fs.fileChecksum(entry.Path)
+		}
+	}
 
-			// 将上传文件内容复制到新文件
-			if _, err = io.Copy(targetFile, file); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			// JS 显示弹窗通知
-			js := color.Sprintf(`
-			<script>
-				alert("File uploaded successfully\n%s");
-				window.location.href = '/upload-service';
-			</script>
-			`, handler.Filename)
-			color.Fprintln(w, js)
-		} else {
-			// 显示文件上传表单
-			templateString := `
-			<!doctype html>
-			<html>
-				<head><title>Upload</title></head>
-				<body>
-					<h1>File Upload</h1>
-					<hr>
-					<a href="/">Back to Home Page</a>
-					<a href="/download-service">Go to Download Page</a>
-					<br><br>
-					<form action="/upload-service" method="post" enctype="multipart/form-data">
-						<input type="file" name="file">
-						<input type="submit" value="Upload">
-					</form>
-				</body>
-			</html>
-			`
-			newTemplate, _ := template.New("upload").Parse(templateString)
-			newTemplate.Execute(w, nil)
+	// 显示校验和时排序链接保持显示，切换链接保持排序
+	checksumQuery := url.Values{}
+	for _, key := range []string{"sort", "order"} {
+		if value := query.Get(key); value != "" {
+			checksumQuery.Set(key, value)
 		}
-	})
-	ServeMux.HandleFunc("/download-service", func(w http.ResponseWriter, r *http.Request) {
-		// 列出文件夹中的所有文件，并提供下载链接
-		files, err := os.ReadDir(dir)
-		if err != nil {
-			color.Fprintf(w, "Error reading download directory: %s", err)
+	}
+	if checksums {
+		for field, link := range listing.SortLinks {
+			listing.SortLinks[field] = link + "&checksum=" + ChecksumSHA256
 		}
+	} else {
+		checksumQuery.Set("checksum", ChecksumSHA256)
+	}
 
-		templateString := `
-		<!doctype html>
-		<html>
-			<head><title>Download</title></head>
-			<body>
-				<h1>File Download</h1>
-				<hr>
-				<a href="/">Back to Home Page</a>
-				<a href="/upload-service">Go to Upload Page</a>
-				<ul>
-					{{range .}}
-						<li><a href="/download/{{.Name}}">{{.Name}}</a></li>
-					{{end}}
-				</ul>
-			</body>
-		</html>
-		`
-		newTemplate, _ := template.New("download").Parse(templateString)
-		newTemplate.Execute(w, files)
+	permissions := fs.options.Permissions
+	fs.render(w, "download", map[string]interface{}{
+		"Navigation":   fs.navigation(),
+		"Listing":      listing,
+		"Permissions":  permissions,
+		"Modify":       permissions.Delete || permissions.Rename || permissions.Mkdir,
+		"Checksums":    checksums,
+		"ChecksumHref": "?" + checksumQuery.Encode(),
 	})
-	// 注册给定模式的处理程序
-	ServeMux.Handle("/download/", http.StripPrefix("/download/", http.FileServer(http.Dir(dir))))
+}
 
-	// 创建 HTTP 服务器
-	HttpServer = &http.Server{
-		Handler: ServeMux, // 调用的处理程序
+// handleArchive 将目录或目录中选择的文件打包为 zip 或 tar.gz 并以流的形式下载
+//
+// 请求参数 format 指定打包格式，默认为 zip；请求参数 file 可重复，指定目录中要打包的文件或子目录
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleArchive(w http.ResponseWriter, r *http.Request) {
+	name := CleanURLPath(strings.TrimPrefix(r.URL.Path, "/archive"))
+	if hasInternalSegment(name) {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = ArchiveZip
+	}
+	if format != ArchiveZip && format != ArchiveTarGz {
+		http.Error(w, fmt.Sprintf("Unsupported archive format: %s", format), http.StatusBadRequest)
+		return
 	}
 
-	// 创建 TCP 监听器
-	listener, err := net.Listen("tcp", address+":"+port)
+	// 开始输出后无法再返回错误状态码，因此先检查所有待打包的路径
+	isDir, err := isDirectory(fs.root, name)
 	if err != nil {
-		return nil, err
-	} else {
-		// 启动 HTTP 服务器
-		go func() {
-			if err := HttpServer.Serve(listener); err == http.ErrServerClosed {
-				log.Println(FgYellowText("HTTP Server closed"))
-				ServeMux = nil
-				HttpServer = nil
-			} else if err != nil {
-				log.Printf("%s\n", DangerText("HTTP server error: ", err))
-				ServeMux = nil
-				HttpServer = nil
-			}
-		}()
+		httpFileError(w, err)
+		return
+	}
+	if !isDir {
+		http.Error(w, "Not a directory", http.StatusBadRequest)
+		return
+	}
+	names := query["file"]
+	for _, fileName := range names {
+		if !IsPlainName(fileName) || IsInternalName(fileName) {
+			http.Error(w, fmt.Sprintf("Invalid file name: %s", fileName), http.StatusBadRequest)
+			return
+		}
+		if _, err := isDirectory(fs.root, path.Join(name, fileName)); err != nil {
+			httpFileError(w, err)
+			return
+		}
+	}
+
+	// 压缩包名称
+	archiveName := path.Base(name)
+	if name == "/" {
+		archiveName = strings.ToLower(Name)
+	}
+	if len(names) == 1 {
+		archiveName = names[0]
+	}
+	archiveName += "." + format
+
+	contentType := "application/zip"
+	if format == ArchiveTarGz {
+		contentType = "application/gzip"
 	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveName}))
+	defer fs.transfers.begin()()
+	recorder := &statusRecorder{ResponseWriter: w}
+	err = WriteArchive(recorder, format, fs.root, name, names)
+	fs.transfers.addDownload(recorder.bytes, err == nil)
+	if err != nil {
+		// 已经开始输出，中断连接让客户端知道下载不完整
+		panic(http.ErrAbortHandler)
+	}
+}
 
-	return HttpServer, nil
+// httpFileError 根据文件操作的错误类型返回对应的 HTTP 错误
+//
+// 参数：
+//   - w: 响应
+//   - err: 文件操作的错误信息
+func httpFileError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case os.IsPermission(err):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, fmt.Sprintf("Error reading download directory: %s", err), http.StatusInternalServerError)
+	}
 }
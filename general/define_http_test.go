@@ -0,0 +1,223 @@
+/*
+File: define_http_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-28 14:03:52
+
+Description: HTTP 文件服务的创建、启动、关闭和请求处理的测试
+*/
+
+package general
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFileServer 创建服务目录为临时目录的 HTTP 文件服务
+//
+// 参数：
+//   - t: 测试
+//   - options: 服务配置，Mode 为空时为 ModeAll，Dir 为空时使用临时目录
+//
+// 返回：
+//   - HTTP 文件服务
+func newTestFileServer(t testing.TB, options ServerOptions) *FileServer {
+	t.Helper()
+	if options.Mode == "" {
+		options.Mode = ModeAll
+	}
+	if options.Dir == "" {
+		options.Dir = t.TempDir()
+	}
+	fileServer, err := NewFileServer(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fileServer
+}
+
+// httpGet 请求指定地址，返回状态码和响应内容
+//
+// 参数：
+//   - t: 测试
+//   - target: 请求地址
+//
+// 返回：
+//   - 状态码
+//   - 响应内容
+func httpGet(t *testing.T, target string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(content)
+}
+
+func TestNewFileServer(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewFileServer(ServerOptions{Mode: "Other", Dir: dir}); err == nil {
+		t.Error("Unsupported mode was accepted")
+	}
+	if _, err := NewFileServer(ServerOptions{Mode: ModeAll}); err == nil {
+		t.Error("Empty directory was accepted")
+	}
+	if _, err := NewFileServer(ServerOptions{Mode: ModeAll, Dir: dir, OnConflict: "Other"}); err == nil {
+		t.Error("Unsupported conflict policy was accepted")
+	}
+
+	// 未指定的配置使用默认值
+	fileServer, err := NewFileServer(ServerOptions{Mode: ModeDownload, Dir: dir, OnConflict: "OVERWRITE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := fileServer.Options()
+	if options.Permissions != ModePermissions(ModeDownload) {
+		t.Errorf("Permissions = %+v, want %+v", options.Permissions, ModePermissions(ModeDownload))
+	}
+	if options.MaxMemory != defaultMaxMemory || options.OnConflict != ConflictOverwrite || options.LogFormat != LogFormatText {
+		t.Errorf("Options = %+v", options)
+	}
+	// 未启动时返回配置的地址
+	fileServer.options.Address, fileServer.options.Port = "127.0.0.1", "8080"
+	if url := fileServer.URL(); url != "http://127.0.0.1:8080" {
+		t.Errorf("URL = %q", url)
+	}
+}
+
+func TestFileServerHandler(t *testing.T) {
+	// 不监听端口，直接使用请求处理器
+	download := newTestFileServer(t, ServerOptions{Mode: ModeDownload})
+	upload := newTestFileServer(t, ServerOptions{Mode: ModeUpload})
+	if err := os.WriteFile(filepath.Join(download.options.Dir, "a.txt"), []byte("download"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		fileServer *FileServer
+		target     string
+		status     int
+		body       string // 响应中应包含的内容
+	}{
+		{"download file", download, "/download/a.txt", http.StatusOK, "download"},
+		{"download listing", download, "/", http.StatusOK, "a.txt"},
+		{"download missing", download, "/download/b.txt", http.StatusNotFound, ""},
+		{"download without upload", download, "/upload", http.StatusForbidden, "Permission denied"},
+		{"upload page", upload, "/", http.StatusOK, "<form"},
+		{"upload without read", upload, "/download/a.txt", http.StatusForbidden, "Permission denied"},
+		{"api", download, "/api/v1/list", http.StatusOK, `"a.txt"`},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		test.fileServer.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.target, nil))
+		if recorder.Code != test.status || !strings.Contains(recorder.Body.String(), test.body) {
+			t.Errorf("%s: status = %d, want %d, body:\n%s", test.name, recorder.Code, test.status, recorder.Body)
+		}
+	}
+
+	// 请求处理器也可以由 httptest.Server 提供服务
+	server := httptest.NewServer(download.Handler())
+	defer server.Close()
+	if status, body := httpGet(t, server.URL+"/download/a.txt"); status != http.StatusOK || body != "download" {
+		t.Errorf("httptest server: status = %d, body = %q", status, body)
+	}
+}
+
+func TestFileServerLifecycle(t *testing.T) {
+	// 同一进程中同时运行两个服务，各自使用独立的路由和服务目录
+	var servers []*FileServer
+	for _, content := range []string{"first", "second"} {
+		fileServer := newTestFileServer(t, ServerOptions{Mode: ModeDownload, Address: "127.0.0.1", Port: "0"})
+		if err := os.WriteFile(filepath.Join(fileServer.options.Dir, "a.txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := fileServer.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		defer fileServer.Shutdown(context.Background())
+		servers = append(servers, fileServer)
+	}
+
+	for index, content := range []string{"first", "second"} {
+		fileServer := servers[index]
+		host, port, err := net.SplitHostPort(fileServer.Addr())
+		if err != nil || host != "127.0.0.1" || port == "0" {
+			t.Errorf("Addr = %q, want the port assigned by the system", fileServer.Addr())
+		}
+		if !strings.HasPrefix(fileServer.URL(), "http://127.0.0.1:") {
+			t.Errorf("URL = %q", fileServer.URL())
+		}
+		if status, body := httpGet(t, fileServer.URL()+"/download/a.txt"); status != http.StatusOK || body != content {
+			t.Errorf("Server %d: status = %d, body = %q, want %q", index, status, body, content)
+		}
+	}
+	if servers[0].Addr() == servers[1].Addr() {
+		t.Errorf("Both servers listen on %s", servers[0].Addr())
+	}
+	if err := servers[0].Start(context.Background()); err == nil {
+		t.Error("Server was started twice")
+	}
+
+	// 关闭一个服务不影响另一个服务
+	url := servers[0].URL()
+	if err := servers[0].Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := servers[0].Wait(); err != nil {
+		t.Errorf("Wait after shutdown = %v", err)
+	}
+	if resp, err := http.Get(url + "/download/a.txt"); err == nil {
+		resp.Body.Close()
+		t.Error("Server still accepts requests after shutdown")
+	}
+	if err := servers[0].Shutdown(context.Background()); err != nil {
+		t.Errorf("Second shutdown = %v", err)
+	}
+	if status, _ := httpGet(t, servers[1].URL()+"/download/a.txt"); status != http.StatusOK {
+		t.Errorf("Other server: status = %d", status)
+	}
+
+	// 关闭后可以再次启动
+	if err := servers[0].Start(context.Background()); err != nil {
+		t.Fatalf("Restart = %v", err)
+	}
+	if status, body := httpGet(t, servers[0].URL()+"/download/a.txt"); status != http.StatusOK || body != "first" {
+		t.Errorf("Restarted server: status = %d, body = %q", status, body)
+	}
+}
+
+func TestFileServerContextCancel(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{Address: "127.0.0.1", Port: "0"})
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := fileServer.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上下文结束时服务关闭，Wait 返回
+	cancel()
+	done := make(chan error, 1)
+	go func() { done <- fileServer.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Wait = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server did not stop after the context was cancelled")
+	}
+}
@@ -0,0 +1,233 @@
+/*
+File: define_listing.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-07-22 09:35:48
+
+Description: 生成目录列表
+*/
+
+package general
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 目录列表支持的排序字段
+const (
+	SortByName = "name" // 按名称排序
+	SortBySize = "size" // 按大小排序
+	SortByTime = "time" // 按修改时间排序
+)
+
+// 目录列表支持的排序方向
+const (
+	OrderAsc  = "asc"  // 升序
+	OrderDesc = "desc" // 降序
+)
+
+// ListingEntry 目录列表中的一项
+type ListingEntry struct {
+	Name        string    // 名称
+	Path        string    // 相对于服务目录的路径，以 "/" 开头
+	Href        string    // 链接
+	IsDir       bool      // 是否是目录
+	Size        int64     // 大小（字节）
+	SizeText    string    // 可读的大小，目录为 "-"
+	ModTime     time.Time // 修改时间
+	ModTimeText string    // 可读的修改时间
+	ArchiveHref string    // 打包下载链接，仅目录有效
+	SHA256      string    // SHA-256 校验和，仅在需要时计算，目录为空
+}
+
+// Breadcrumb 面包屑导航中的一级
+type Breadcrumb struct {
+	Name string // 名称
+	Href string // 链接
+}
+
+// Listing 目录列表
+type Listing struct {
+	Path        string            // 当前目录相对于服务目录的路径，以 "/" 开头和结尾
+	Parent      string            // 上级目录链接，当前目录是服务目录时为空
+	Breadcrumbs []Breadcrumb      // 面包屑导航
+	Entries     []ListingEntry    // 目录中的项
+	Sort        string            // 排序字段
+	Order       string            // 排序方向
+	SortLinks   map[string]string // 各排序字段对应的链接，点击当前排序字段时切换排序方向
+	ArchiveHref string            // 当前目录的打包下载链接
+}
+
+// CleanURLPath 清理 URL 路径，结果总是以 "/" 开头且不包含 ".." 段
+//
+// 参数：
+//   - urlPath: URL 路径
+//
+// 返回：
+//   - 清理后的路径
+func CleanURLPath(urlPath string) string {
+	return path.Clean("/" + urlPath)
+}
+
+// EscapeURLPath 对 URL 路径的每一段进行转义
+//
+// 参数：
+//   - urlPath: 未转义的 URL 路径
+//
+// 返回：
+//   - 转义后的路径
+func EscapeURLPath(urlPath string) string {
+	return (&url.URL{Path: urlPath}).EscapedPath()
+}
+
+// ReadListing 读取目录并生成目录列表
+//
+// 参数：
+//   - root: 服务目录
+//   - dirPath: 要列出的目录相对于服务目录的路径
+//   - prefix: 链接前缀，例如 "/download"
+//   - sortBy: 排序字段，可选 SortByName、SortBySize、SortByTime
+//   - order: 排序方向，可选 OrderAsc、OrderDesc
+//
+// 返回：
+//   - 目录列表
+//   - 错误信息
+func ReadListing(root http.FileSystem, dirPath, prefix, sortBy, order string) (*Listing, error) {
+	dirPath = CleanURLPath(dirPath)
+	if sortBy != SortBySize && sortBy != SortByTime {
+		sortBy = SortByName
+	}
+	if order != OrderDesc {
+		order = OrderAsc
+	}
+
+	dir, err := root.Open(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	fileInfos, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	// 当前目录路径以 "/" 结尾，便于拼接
+	basePath := strings.TrimSuffix(dirPath, "/") + "/"
+	listing := &Listing{
+		Path:      basePath,
+		Sort:      sortBy,
+		Order:     order,
+		SortLinks: make(map[string]string),
+	}
+
+	// 生成目录中的项
+	for _, fileInfo := range fileInfos {
+		if IsInternalName(fileInfo.Name()) {
+			continue
+		}
+		entryPath := basePath + fileInfo.Name()
+		entry := ListingEntry{
+			Name:        fileInfo.Name(),
+			Path:        entryPath,
+			IsDir:       fileInfo.IsDir(),
+			Size:        fileInfo.Size(),
+			SizeText:    FormatSize(fileInfo.Size()),
+			ModTime:     fileInfo.ModTime(),
+			ModTimeText: fileInfo.ModTime().Format("2006-01-02 15:04:05"),
+		}
+		if entry.IsDir {
+			entry.Path += "/"
+			entry.Size = 0
+			entry.SizeText = "-"
+		}
+		entry.Href = EscapeURLPath(prefix + entry.Path)
+		listing.Entries = append(listing.Entries, entry)
+	}
+	SortListingEntries(listing.Entries, sortBy, order)
+
+	// 生成面包屑导航和上级目录链接
+	listing.Breadcrumbs = append(listing.Breadcrumbs, Breadcrumb{Name: "Home", Href: EscapeURLPath(prefix + "/")})
+	crumbPath := "/"
+	for _, segment := range strings.Split(strings.Trim(basePath, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		crumbPath += segment + "/"
+		listing.Breadcrumbs = append(listing.Breadcrumbs, Breadcrumb{Name: segment, Href: EscapeURLPath(prefix + crumbPath)})
+	}
+	if len(listing.Breadcrumbs) > 1 {
+		listing.Parent = listing.Breadcrumbs[len(listing.Breadcrumbs)-2].Href
+	}
+
+	// 生成排序链接
+	for _, field := range []string{SortByName, SortBySize, SortByTime} {
+		fieldOrder := OrderAsc
+		if field == sortBy && order == OrderAsc {
+			fieldOrder = OrderDesc
+		}
+		listing.SortLinks[field] = "?sort=" + field + "&order=" + fieldOrder
+	}
+
+	return listing, nil
+}
+
+// SortListingEntries 对目录列表中的项排序，目录总是排在文件之前
+//
+// 参数：
+//   - entries: 目录中的项
+//   - sortBy: 排序字段
+//   - order: 排序方向
+func SortListingEntries(entries []ListingEntry, sortBy, order string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+
+		var less, equal bool
+		switch sortBy {
+		case SortBySize:
+			less, equal = a.Size < b.Size, a.Size == b.Size
+		case SortByTime:
+			less, equal = a.ModTime.Before(b.ModTime), a.ModTime.Equal(b.ModTime)
+		}
+		if sortBy == SortByName || equal {
+			nameA, nameB := strings.ToLower(a.Name), strings.ToLower(b.Name)
+			less, equal = nameA < nameB, nameA == nameB
+		}
+
+		if order == OrderDesc {
+			return !less && !equal
+		}
+		return less
+	})
+}
+
+// openFile 打开服务目录中的文件或目录
+//
+// 参数：
+//   - root: 服务目录
+//   - name: 相对于服务目录的路径
+//
+// 返回：
+//   - 文件
+//   - 文件信息
+//   - 错误信息
+func openFile(root http.FileSystem, name string) (http.File, os.FileInfo, error) {
+	file, err := root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, fileInfo, nil
+}
@@ -0,0 +1,240 @@
+/*
+File: define_operation.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-07 16:05:12
+
+Description: 删除、重命名文件和创建目录
+*/
+
+package general
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// OperationResult 文件操作的结果
+type OperationResult struct {
+	Path  string `json:"path"`            // 操作后文件或目录相对于服务目录的路径
+	Error string `json:"error,omitempty"` // 错误信息，操作成功时为空
+}
+
+// handleDelete 删除文件或目录（POST），目录会连同其中的内容一起删除
+//
+// 请求参数 path 指定要删除的文件或目录相对于服务目录的路径
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	relativePath, targetPath, err := ResolveExistingPath(fs.options.Dir, r.FormValue("path"))
+	if err == nil {
+		err = fs.removeAll(targetPath)
+	}
+	fs.writeOperationResult(w, r, relativePath, path.Dir("/"+relativePath), err)
+}
+
+// handleRename 在同一目录中重命名文件或目录（POST），新名称已存在时返回 409
+//
+// 请求参数 path 指定文件或目录相对于服务目录的路径，name 指定新名称
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleRename(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	relativePath, targetPath, err := ResolveExistingPath(fs.options.Dir, r.FormValue("path"))
+	if err != nil {
+		fs.writeOperationResult(w, r, relativePath, "/", err)
+		return
+	}
+	name, err := SanitizeFileName(r.FormValue("name"))
+	if err == nil && IsInternalName(name) {
+		err = ErrUnsafePath
+	}
+	if err != nil {
+		fs.writeOperationResult(w, r, relativePath, path.Dir("/"+relativePath), err)
+		return
+	}
+
+	newPath := path.Join(path.Dir(relativePath), name)
+	newTargetPath := filepath.Join(filepath.Dir(targetPath), name)
+	if _, err := os.Lstat(newTargetPath); err == nil {
+		fs.writeOperationResult(w, r, newPath, path.Dir("/"+relativePath), ErrFileExists)
+		return
+	}
+	fs.writeOperationResult(w, r, newPath, path.Dir("/"+relativePath), os.Rename(targetPath, newTargetPath))
+}
+
+// handleMove 将文件或目录移动到服务目录中的另一个目录（POST），目标目录中已存在同名项时返回 409
+//
+// 请求参数 path 指定文件或目录相对于服务目录的路径，to 指定目标目录相对于服务目录的路径，"/" 代表服务目录
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleMove(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	relativePath, targetPath, err := ResolveExistingPath(fs.options.Dir, r.FormValue("path"))
+	if err != nil {
+		fs.writeOperationResult(w, r, relativePath, "/", err)
+		return
+	}
+	dirPath := path.Dir("/" + relativePath)
+
+	// 解析目标目录，"/" 代表服务目录本身
+	destPath, destDir := "", ""
+	if CleanURLPath(r.FormValue("to")) == "/" {
+		destDir, err = filepath.Abs(fs.options.Dir)
+	} else {
+		destPath, destDir, err = ResolveExistingPath(fs.options.Dir, r.FormValue("to"))
+	}
+	// 目标目录可能是符号链接，解析后必须仍位于服务目录中
+	if err == nil && destPath != "" {
+		err = checkWithinRoot(fs.options.Dir, destDir)
+	}
+	if err == nil {
+		if fileInfo, statErr := os.Stat(destDir); statErr != nil {
+			err = statErr
+		} else if !fileInfo.IsDir() {
+			err = errors.New("Not a directory")
+		}
+	}
+	// 目录不能移动到其自身或其子目录中
+	if err == nil && (destPath == relativePath || strings.HasPrefix(destPath, relativePath+"/")) {
+		err = ErrUnsafePath
+	}
+	if err != nil {
+		fs.writeOperationResult(w, r, relativePath, dirPath, err)
+		return
+	}
+
+	newPath := path.Join(destPath, path.Base(relativePath))
+	newTargetPath := filepath.Join(destDir, filepath.Base(targetPath))
+	if _, err := os.Lstat(newTargetPath); err == nil {
+		fs.writeOperationResult(w, r, newPath, dirPath, ErrFileExists)
+		return
+	}
+	fs.writeOperationResult(w, r, newPath, dirPath, os.Rename(targetPath, newTargetPath))
+}
+
+// handleMkdir 创建目录（POST），必要时创建中间目录，目录已存在时返回 409
+//
+// 请求参数 path 指定新目录相对于服务目录的路径，与下载页面中的路径一样可以以 / 开头
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleMkdir(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	relativePath, targetPath, err := ResolveUploadPath(fs.options.Dir, strings.TrimPrefix(r.FormValue("path"), "/"))
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(targetPath), os.ModePerm); err == nil {
+			err = os.Mkdir(targetPath, os.ModePerm)
+		}
+	}
+	if os.IsExist(err) || errors.Is(err, ErrIsDir) {
+		err = ErrFileExists
+	}
+	fs.writeOperationResult(w, r, relativePath, path.Dir("/"+relativePath), err)
+}
+
+// requirePost 要求请求方法为 POST，否则返回 405
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+//
+// 返回：
+//   - 请求方法是否为 POST
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodPost {
+		return true
+	}
+	w.Header().Set("Allow", http.MethodPost)
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	return false
+}
+
+// writeOperationResult 输出文件操作的结果
+//
+// 请求的 Accept 头包含 application/json 时以 OperationResult 的 JSON 格式返回结果；
+// 否则操作失败时返回错误信息，成功时重定向到操作所在目录的下载页面
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+//   - relativePath: 操作后文件或目录相对于服务目录的路径
+//   - dirPath: 操作所在目录相对于服务目录的路径
+//   - err: 操作的错误信息
+func (fs *FileServer) writeOperationResult(w http.ResponseWriter, r *http.Request, relativePath, dirPath string, err error) {
+	status, message := http.StatusOK, ""
+	if err != nil {
+		status, message = operationErrorStatus(err)
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, status, OperationResult{Path: relativePath, Error: message})
+		return
+	}
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+	location := "/"
+	if fs.options.Permissions.Read {
+		location = EscapeURLPath("/download" + strings.TrimSuffix(CleanURLPath(dirPath), "/") + "/")
+	}
+	http.Redirect(w, r, location, http.StatusSeeOther)
+}
+
+// operationErrorStatus 根据文件操作的错误类型返回 HTTP 状态码和错误信息
+//
+// 错误信息中不包含服务目录的绝对路径
+//
+// 参数：
+//   - err: 文件操作的错误信息
+//
+// 返回：
+//   - HTTP 状态码
+//   - 错误信息
+func operationErrorStatus(err error) (int, string) {
+	var pathError *os.PathError
+	var linkError *os.LinkError
+	switch {
+	case errors.Is(err, ErrFileExists), errors.Is(err, ErrIsDir):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, ErrUnsafePath), errors.Is(err, ErrEmptyName):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, ErrChecksumMismatch):
+		return http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, ErrUploadTooLarge):
+		return http.StatusRequestEntityTooLarge, err.Error()
+	case errors.Is(err, ErrQuotaExceeded), errors.Is(err, ErrInsufficientSpace):
+		return http.StatusInsufficientStorage, err.Error()
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound, "Not found"
+	case errors.Is(err, os.ErrPermission):
+		return http.StatusForbidden, "Permission denied"
+	case errors.As(err, &pathError):
+		return http.StatusInternalServerError, pathError.Err.Error()
+	case errors.As(err, &linkError):
+		return http.StatusInternalServerError, linkError.Err.Error()
+	default:
+		return http.StatusBadRequest, err.Error()
+	}
+}
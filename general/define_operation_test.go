@@ -0,0 +1,127 @@
+/*
+File: define_operation_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-26 16:20:51
+
+Description: 文件操作的测试
+*/
+
+package general
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// postForm 以表单形式向服务发送 POST 请求，要求返回 JSON
+//
+// 参数：
+//   - fileServer: HTTP 文件服务
+//   - target: 请求路径
+//   - form: 表单字段
+//
+// 返回：
+//   - 响应
+func postForm(fileServer *FileServer, target string, form url.Values) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestMoveSymlinkDestination(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{Permissions: Permissions{Read: true, Rename: true}})
+	root := fileServer.options.Dir
+	outside := t.TempDir()
+	for _, name := range []string{"secret.txt", "public.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "sub"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("Symlinks are not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "inner")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 指向服务目录之外的符号链接不能作为目标目录
+	for _, prefix := range []string{"", "/api/v1"} {
+		recorder := postForm(fileServer, prefix+"/move", url.Values{"path": {"secret.txt"}, "to": {"link"}})
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s/move to link: status = %d, want %d: %s", prefix, recorder.Code, http.StatusBadRequest, recorder.Body)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatalf("File was moved outside the root: %v", entries)
+	}
+	if !FileExist(filepath.Join(root, "secret.txt")) {
+		t.Fatal("Source file is missing")
+	}
+
+	// 指向服务目录之中的符号链接可以作为目标目录
+	recorder := postForm(fileServer, "/move", url.Values{"path": {"public.txt"}, "to": {"inner"}})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("/move to inner: status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	if !FileExist(filepath.Join(root, "sub", "public.txt")) {
+		t.Error("File was not moved into the linked directory")
+	}
+}
+
+func TestMkdir(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{Permissions: Permissions{Read: true, Mkdir: true}})
+	root := fileServer.options.Dir
+	tests := []struct {
+		name string
+		path string // 下载页面发送的路径为当前目录加上新目录名
+		want int
+		dir  string // 期望创建的目录，为空时不检查
+	}{
+		{"page at root", "/newfolder", http.StatusOK, "newfolder"},
+		{"page in subdirectory", "/newfolder/child", http.StatusOK, "newfolder/child"},
+		{"relative", "relative", http.StatusOK, "relative"},
+		{"nested", "a/b/c", http.StatusOK, "a/b/c"},
+		{"exists", "/newfolder", http.StatusConflict, ""},
+		{"root", "/", http.StatusBadRequest, ""},
+		{"parent", "/../escape", http.StatusBadRequest, ""},
+		{"double slash", "//escape", http.StatusBadRequest, ""},
+	}
+	for _, prefix := range []string{"", "/api/v1"} {
+		for _, test := range tests {
+			target := test.path
+			if prefix != "" && test.dir != "" {
+				target += "-api"
+			}
+			recorder := postForm(fileServer, prefix+"/mkdir", url.Values{"path": {target}})
+			if recorder.Code != test.want {
+				t.Errorf("%s/mkdir %s: status = %d, want %d: %s", prefix, test.name, recorder.Code, test.want, recorder.Body)
+				continue
+			}
+			if test.dir == "" {
+				continue
+			}
+			dir := test.dir
+			if prefix != "" {
+				dir += "-api"
+			}
+			if fileInfo, err := os.Stat(filepath.Join(root, filepath.FromSlash(dir))); err != nil || !fileInfo.IsDir() {
+				t.Errorf("%s/mkdir %s: directory %s was not created: %v", prefix, test.name, dir, err)
+			}
+		}
+	}
+	if FileExist(filepath.Join(filepath.Dir(root), "escape")) {
+		t.Error("Directory was created outside the root")
+	}
+}
@@ -0,0 +1,272 @@
+/*
+File: define_path.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-07-29 15:40:11
+
+Description: 校验和清理客户端提供的路径
+*/
+
+package general
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrUnsafePath = errors.New("Unsafe path")    // 路径试图访问服务目录之外的位置
+	ErrEmptyName  = errors.New("Empty name")     // 清理后名称为空
+	ErrIsDir      = errors.New("Is a directory") // 目标是已存在的目录
+)
+
+// maxNameLength 单个文件名的最大长度（字节），与大多数文件系统的限制一致
+const maxNameLength = 255
+
+// Windows 保留的设备名，无论是否带扩展名都不能用作文件名
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFileName 清理单个文件名
+//
+// 去除控制字符，将 Windows 不允许的字符替换为 "_"，去除首尾空白和结尾的 "."，
+// 并为 Windows 保留的设备名添加 "_" 前缀，保证文件名在各平台上都能安全使用
+//
+// 参数：
+//   - name: 文件名，不能包含路径分隔符
+//
+// 返回：
+//   - 清理后的文件名
+//   - 错误信息
+func SanitizeFileName(name string) (string, error) {
+	var builder strings.Builder
+	for _, char := range name {
+		switch {
+		case unicode.IsControl(char) || char == unicode.ReplacementChar:
+			continue
+		case strings.ContainsRune(`<>:"|?*`, char):
+			builder.WriteRune('_')
+		case char == '/' || char == '\\':
+			return "", ErrUnsafePath
+		default:
+			builder.WriteRune(char)
+		}
+	}
+
+	cleaned := strings.TrimRight(strings.TrimSpace(builder.String()), ". ")
+	if cleaned == "" {
+		return "", ErrEmptyName
+	}
+
+	// Windows 保留的设备名（例如 "CON"、"nul.txt"）
+	baseName := strings.ToUpper(strings.SplitN(cleaned, ".", 2)[0])
+	if windowsReservedNames[strings.TrimSpace(baseName)] {
+		cleaned = "_" + cleaned
+	}
+
+	if len(cleaned) > maxNameLength {
+		return "", errors.New("Name too long")
+	}
+	return cleaned, nil
+}
+
+// SanitizeRelativePath 清理客户端提供的相对路径
+//
+// "\" 视为路径分隔符，空段和 "." 段被忽略，绝对路径、盘符和 ".." 段被拒绝，其余每一段使用 SanitizeFileName 清理
+//
+// 参数：
+//   - name: 客户端提供的相对路径，例如 "photos/2024/a.jpg"
+//
+// 返回：
+//   - 以 "/" 分隔的清理后的相对路径
+//   - 错误信息
+func SanitizeRelativePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" || hasDriveLetter(name) {
+		return "", ErrUnsafePath
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." {
+			continue
+		}
+		if segment == ".." {
+			return "", ErrUnsafePath
+		}
+		cleaned, err := SanitizeFileName(segment)
+		if err != nil {
+			return "", err
+		}
+		if IsInternalName(cleaned) {
+			return "", ErrUnsafePath
+		}
+		segments = append(segments, cleaned)
+	}
+	if len(segments) == 0 {
+		return "", ErrEmptyName
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// hasDriveLetter 判断路径是否以 Windows 盘符开头，例如 "C:"
+//
+// 参数：
+//   - name: 路径
+//
+// 返回：
+//   - 是否以盘符开头
+func hasDriveLetter(name string) bool {
+	return len(name) >= 2 && name[1] == ':' && unicode.IsLetter(rune(name[0]))
+}
+
+// ResolveUploadPath 将客户端提供的相对路径解析为服务目录中的绝对路径
+//
+// 路径经过 SanitizeRelativePath 清理，并确认解析符号链接后仍位于服务目录中，
+// 已存在的目标是符号链接或目录时返回错误，防止写入服务目录之外的位置
+//
+// 参数：
+//   - root: 服务目录
+//   - name: 客户端提供的相对路径
+//
+// 返回：
+//   - 清理后以 "/" 分隔的相对路径
+//   - 目标文件的绝对路径
+//   - 错误信息
+func ResolveUploadPath(root, name string) (string, string, error) {
+	relativePath, err := SanitizeRelativePath(name)
+	if err != nil {
+		return "", "", err
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", "", err
+	}
+	targetPath := filepath.Join(absRoot, filepath.FromSlash(relativePath))
+	if !isWithin(absRoot, targetPath) {
+		return "", "", ErrUnsafePath
+	}
+
+	// 已存在的最深一级上级目录解析符号链接后必须仍位于服务目录中
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return "", "", err
+	}
+	ancestor := filepath.Dir(targetPath)
+	for !FileExist(ancestor) && ancestor != absRoot {
+		ancestor = filepath.Dir(ancestor)
+	}
+	realAncestor, err := filepath.EvalSymlinks(ancestor)
+	if err != nil {
+		return "", "", err
+	}
+	if !isWithin(realRoot, realAncestor) {
+		return "", "", ErrUnsafePath
+	}
+
+	// 目标本身不能是符号链接或目录
+	if fileInfo, err := os.Lstat(targetPath); err == nil {
+		if fileInfo.Mode()&os.ModeSymlink != 0 {
+			return "", "", ErrUnsafePath
+		}
+		if fileInfo.IsDir() {
+			return "", "", ErrIsDir
+		}
+	}
+
+	return relativePath, targetPath, nil
+}
+
+// ResolveExistingPath 将客户端提供的路径解析为服务目录中已存在的文件或目录的绝对路径
+//
+// 路径不能是服务目录本身或内部文件，其所在目录解析符号链接后必须仍位于服务目录中；
+// 路径本身是符号链接时返回链接本身的路径，而不是链接指向的位置
+//
+// 参数：
+//   - root: 服务目录
+//   - name: 客户端提供的路径，例如 "/photos/a.jpg"
+//
+// 返回：
+//   - 清理后以 "/" 分隔的相对路径
+//   - 文件或目录的绝对路径
+//   - 错误信息
+func ResolveExistingPath(root, name string) (string, string, error) {
+	relativePath := strings.TrimPrefix(CleanURLPath(strings.ReplaceAll(name, `\`, "/")), "/")
+	if relativePath == "" {
+		return "", "", ErrUnsafePath
+	}
+	if hasInternalSegment(relativePath) {
+		return "", "", os.ErrNotExist
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", "", err
+	}
+	targetPath := filepath.Join(absRoot, filepath.FromSlash(relativePath))
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return "", "", err
+	}
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(targetPath))
+	if err != nil {
+		return "", "", err
+	}
+	if !isWithin(realRoot, realParent) {
+		return "", "", ErrUnsafePath
+	}
+	if _, err := os.Lstat(targetPath); err != nil {
+		return "", "", err
+	}
+	return relativePath, targetPath, nil
+}
+
+// checkWithinRoot 确认已存在的路径解析符号链接后仍位于服务目录中
+//
+// 参数：
+//   - root: 服务目录
+//   - targetPath: 服务目录中的绝对路径
+//
+// 返回：
+//   - 错误信息，位于服务目录之外时为 ErrUnsafePath
+func checkWithinRoot(root, targetPath string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return err
+	}
+	realTarget, err := filepath.EvalSymlinks(targetPath)
+	if err != nil {
+		return err
+	}
+	if !isWithin(realRoot, realTarget) {
+		return ErrUnsafePath
+	}
+	return nil
+}
+
+// isWithin 判断路径是否位于目录之中（或就是该目录）
+//
+// 参数：
+//   - dir: 目录的绝对路径
+//   - target: 路径的绝对路径
+//
+// 返回：
+//   - 是否位于目录之中
+func isWithin(dir, target string) bool {
+	relativePath, err := filepath.Rel(dir, target)
+	if err != nil {
+		return false
+	}
+	return relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) && !filepath.IsAbs(relativePath)
+}
@@ -0,0 +1,217 @@
+/*
+File: define_path_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-26 10:12:40
+
+Description: 客户端路径校验和清理的测试
+*/
+
+package general
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// errAny 表示期望返回错误，但不关心具体是哪个错误
+var errAny = errors.New("any error")
+
+// checkError 比较实际返回的错误与期望的错误
+//
+// 参数：
+//   - t: 测试
+//   - input: 测试输入
+//   - got: 实际返回的错误
+//   - want: 期望的错误，为 nil 时期望成功，为 errAny 时期望任意错误
+//
+// 返回：
+//   - 是否返回了错误
+func checkError(t *testing.T, input string, got, want error) bool {
+	t.Helper()
+	switch {
+	case want == nil && got != nil:
+		t.Errorf("%q: unexpected error: %v", input, got)
+	case want == errAny && got == nil, want != nil && want != errAny && !errors.Is(got, want):
+		t.Errorf("%q: got error %v, want %v", input, got, want)
+	}
+	return got != nil
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"a.txt", "a.txt", nil},
+		{"  report 2024.pdf  ", "report 2024.pdf", nil},
+		{"../a.txt", "", ErrUnsafePath},
+		{"..", "", ErrEmptyName},
+		{"...", "", ErrEmptyName},
+		{`..\a.txt`, "", ErrUnsafePath},
+		{"/etc/passwd", "", ErrUnsafePath},
+		{`C:\Windows\win.ini`, "", ErrUnsafePath},
+		{"C:", "C_", nil},
+		{`a<b>:c"d|e?f*.txt`, "a_b__c_d_e_f_.txt", nil},
+		{"a\x00b\x1f\x7fc.txt", "abc.txt", nil},
+		{"line\nbreak\r.txt", "linebreak.txt", nil},
+		{"invalid\xffutf8.txt", "invalidutf8.txt", nil},
+		{"\x00\x01", "", ErrEmptyName},
+		{"", "", ErrEmptyName},
+		{"name. . ", "name", nil},
+		{"CON", "_CON", nil},
+		{"con", "_con", nil},
+		{"nul.txt", "_nul.txt", nil},
+		{"LPT1.tar.gz", "_LPT1.tar.gz", nil},
+		{"console.txt", "console.txt", nil},
+		{"COM10", "COM10", nil},
+		{strings.Repeat("a", maxNameLength), strings.Repeat("a", maxNameLength), nil},
+		{strings.Repeat("a", maxNameLength+1), "", errAny},
+		{strings.Repeat("文", maxNameLength/3+1), "", errAny},
+		{".skynet-uploads", ".skynet-uploads", nil}, // 单个文件名不检查内部前缀，由 SanitizeRelativePath 拒绝
+	}
+	for _, test := range tests {
+		got, err := SanitizeFileName(test.name)
+		if checkError(t, test.name, err, test.err) {
+			continue
+		}
+		if got != test.want {
+			t.Errorf("SanitizeFileName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSanitizeRelativePath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"a.txt", "a.txt", nil},
+		{"photos/2024/a.jpg", "photos/2024/a.jpg", nil},
+		{`photos\2024\a.jpg`, "photos/2024/a.jpg", nil},
+		{"./a//b/./c.txt/", "a/b/c.txt", nil},
+		{"../a.txt", "", ErrUnsafePath},
+		{"a/../../b.txt", "", ErrUnsafePath},
+		{"a/..", "", ErrUnsafePath},
+		{`..\..\Windows\win.ini`, "", ErrUnsafePath},
+		{`a\..\..\b.txt`, "", ErrUnsafePath},
+		{"/etc/passwd", "", ErrUnsafePath},
+		{`\Windows\win.ini`, "", ErrUnsafePath},
+		{`\\server\share\a.txt`, "", ErrUnsafePath},
+		{`C:\Windows\win.ini`, "", ErrUnsafePath},
+		{"C:/Windows/win.ini", "", ErrUnsafePath},
+		{"c:a.txt", "", ErrUnsafePath},
+		{"sub/C:/a.txt", "sub/C_/a.txt", nil},
+		{"sub/CON/nul.txt", "sub/_CON/_nul.txt", nil},
+		{"a\x00/b\x1b[31m.txt", "a/b[31m.txt", nil},
+		{"a/\x00\x01/b.txt", "", ErrEmptyName},
+		{"sub/. ./a.txt", "", ErrEmptyName},
+		{"sub/" + strings.Repeat("a", maxNameLength+1), "", errAny},
+		{".skynet-uploads/session.json", "", ErrUnsafePath},
+		{"sub/.skynet-upload-1234.tmp", "", ErrUnsafePath},
+		{"sub/.skynet-", "", ErrUnsafePath},
+		{".skynet", ".skynet", nil},
+		{"", "", ErrEmptyName},
+		{"./", "", ErrEmptyName},
+		{"//", "", ErrUnsafePath},
+	}
+	for _, test := range tests {
+		got, err := SanitizeRelativePath(test.name)
+		if checkError(t, test.name, err, test.err) {
+			continue
+		}
+		if got != test.want {
+			t.Errorf("SanitizeRelativePath(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestResolveUploadPath(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"a.txt", "a.txt", nil},
+		{`sub\new\a.txt`, "sub/new/a.txt", nil},
+		{"sub", "", ErrIsDir},
+		{"../a.txt", "", ErrUnsafePath},
+		{"sub/../../a.txt", "", ErrUnsafePath},
+		{`..\a.txt`, "", ErrUnsafePath},
+		{"/etc/passwd", "", ErrUnsafePath},
+		{`C:\a.txt`, "", ErrUnsafePath},
+		{"sub/NUL", "sub/_NUL", nil},
+		{".skynet-uploads/a.txt", "", ErrUnsafePath},
+	}
+	for _, test := range tests {
+		relativePath, targetPath, err := ResolveUploadPath(root, test.name)
+		if checkError(t, test.name, err, test.err) {
+			continue
+		}
+		if relativePath != test.want {
+			t.Errorf("ResolveUploadPath(%q) relative path = %q, want %q", test.name, relativePath, test.want)
+		}
+		if wantPath := filepath.Join(root, filepath.FromSlash(test.want)); targetPath != wantPath {
+			t.Errorf("ResolveUploadPath(%q) target path = %q, want %q", test.name, targetPath, wantPath)
+		}
+	}
+}
+
+func TestResolveUploadPathSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "sub"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"out":        outside,                                // 指向服务目录之外的目录
+		"sub/nested": outside,                                // 位于子目录中，指向服务目录之外的目录
+		"secret.txt": filepath.Join(outside, "secret.txt"),   // 指向服务目录之外的文件
+		"inner":      filepath.Join(root, "sub"),             // 指向服务目录之中的目录
+		"dangling":   filepath.Join(outside, "missing", "x"), // 指向不存在的位置
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+			t.Skipf("Symlinks are not supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want string
+		err  error
+	}{
+		{"out/a.txt", "", ErrUnsafePath},
+		{"out/deeper/a.txt", "", ErrUnsafePath},
+		{"sub/nested/a.txt", "", ErrUnsafePath},
+		{"secret.txt", "", ErrUnsafePath},
+		{"dangling", "", ErrUnsafePath},
+		{"inner/a.txt", "inner/a.txt", nil},
+		{"inner/new/a.txt", "inner/new/a.txt", nil},
+	}
+	for _, test := range tests {
+		relativePath, _, err := ResolveUploadPath(root, test.name)
+		if checkError(t, test.name, err, test.err) {
+			continue
+		}
+		if relativePath != test.want {
+			t.Errorf("ResolveUploadPath(%q) relative path = %q, want %q", test.name, relativePath, test.want)
+		}
+	}
+	if entries, err := os.ReadDir(outside); err != nil || len(entries) != 1 {
+		t.Errorf("Directory outside the root was modified: %v %v", entries, err)
+	}
+}
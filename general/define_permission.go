@@ -0,0 +1,184 @@
+/*
+File: define_permission.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-07 14:21:39
+
+Description: HTTP 服务的操作权限
+*/
+
+package general
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 服务目录支持的操作权限
+const (
+	PermRead   = "read"   // 浏览和下载
+	PermUpload = "upload" // 上传文件
+	PermDelete = "delete" // 删除文件或目录
+	PermRename = "rename" // 重命名或移动文件和目录
+	PermMkdir  = "mkdir"  // 创建目录
+)
+
+// PermissionNames 支持的操作权限列表
+var PermissionNames = []string{PermRead, PermUpload, PermDelete, PermRename, PermMkdir}
+
+// Permissions 服务目录的操作权限，每项权限可以单独开启
+type Permissions struct {
+	Read   bool // 浏览和下载
+	Upload bool // 上传文件
+	Delete bool // 删除文件或目录
+	Rename bool // 重命名或移动文件和目录
+	Mkdir  bool // 创建目录
+}
+
+// ModePermissions 返回服务类型对应的默认权限
+//
+// 参数：
+//   - mode: 服务类型，可选 ModeDownload、ModeUpload、ModeAll
+//
+// 返回：
+//   - 默认权限
+func ModePermissions(mode string) Permissions {
+	switch mode {
+	case ModeDownload:
+		return Permissions{Read: true}
+	case ModeUpload:
+		return Permissions{Upload: true}
+	default:
+		return Permissions{Read: true, Upload: true}
+	}
+}
+
+// ParsePermissions 解析权限名称列表，不区分大小写，每一项中可以用 "," 分隔多个权限
+//
+// 参数：
+//   - names: 权限名称列表，例如 ["read", "upload,delete"]
+//
+// 返回：
+//   - 权限
+//   - 错误信息
+func ParsePermissions(names []string) (Permissions, error) {
+	var permissions Permissions
+	for _, item := range names {
+		for _, name := range strings.Split(item, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if !permissions.set(name) {
+				return Permissions{}, fmt.Errorf("Unsupported permission: %s", name)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+// set 开启指定权限
+//
+// 参数：
+//   - name: 权限名称
+//
+// 返回：
+//   - 权限名称是否有效
+func (p *Permissions) set(name string) bool {
+	switch name {
+	case PermRead:
+		p.Read = true
+	case PermUpload:
+		p.Upload = true
+	case PermDelete:
+		p.Delete = true
+	case PermRename:
+		p.Rename = true
+	case PermMkdir:
+		p.Mkdir = true
+	default:
+		return false
+	}
+	return true
+}
+
+// WithModify 返回同时开启了删除、重命名（包括移动）和创建目录权限的副本
+//
+// 返回：
+//   - 开启修改权限后的权限
+func (p Permissions) WithModify() Permissions {
+	p.Delete, p.Rename, p.Mkdir = true, true, true
+	return p
+}
+
+// Has 判断是否拥有指定权限
+//
+// 参数：
+//   - name: 权限名称
+//
+// 返回：
+//   - 是否拥有该权限
+func (p Permissions) Has(name string) bool {
+	switch name {
+	case PermRead:
+		return p.Read
+	case PermUpload:
+		return p.Upload
+	case PermDelete:
+		return p.Delete
+	case PermRename:
+		return p.Rename
+	case PermMkdir:
+		return p.Mkdir
+	}
+	return false
+}
+
+// Names 返回已开启的权限名称列表
+//
+// 返回：
+//   - 权限名称列表，按 PermissionNames 的顺序排列
+func (p Permissions) Names() []string {
+	var names []string
+	for _, name := range PermissionNames {
+		if p.Has(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// String 返回以 "," 分隔的权限名称
+//
+// 返回：
+//   - 权限名称，没有任何权限时为 "none"
+func (p Permissions) String() string {
+	if p == (Permissions{}) {
+		return "none"
+	}
+	return strings.Join(p.Names(), ",")
+}
+
+// require 要求请求拥有指定权限，否则返回 403
+//
+// 参数：
+//   - name: 权限名称
+//   - handler: 请求处理函数
+//
+// 返回：
+//   - 检查权限后的请求处理函数
+func (fs *FileServer) require(name string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !fs.options.Permissions.Has(name) {
+			message := fmt.Sprintf("Permission denied: %s", name)
+			if wantsJSON(r) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": message})
+			} else {
+				http.Error(w, message, http.StatusForbidden)
+			}
+			return
+		}
+		handler(w, r)
+	}
+}
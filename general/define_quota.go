@@ -0,0 +1,458 @@
+/*
+File: define_quota.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-22 15:18:26
+
+Description: 上传大小、存储配额和磁盘剩余空间限制
+*/
+
+package general
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 上传超出限制时的错误
+var (
+	ErrUploadTooLarge    = errors.New("Upload exceeds the maximum upload size")         // 超过单次上传的最大大小，对应 413
+	ErrQuotaExceeded     = errors.New("Upload exceeds the storage quota")               // 超过服务目录的存储配额，对应 507
+	ErrInsufficientSpace = errors.New("Not enough free disk space to store the upload") // 磁盘剩余空间不足，对应 507
+)
+
+// usageCacheDuration 服务目录中文件总大小的缓存时间，期间服务自身的上传和删除直接计入
+const usageCacheDuration = 30 * time.Second
+
+// UploadLimits 上传限制，值小于等于 0 时不限制
+type UploadLimits struct {
+	MaxSize      int64 // 单次上传的最大字节数（单个文件，或一次表单提交的所有文件）
+	Quota        int64 // 服务目录中所有文件的总字节数上限
+	MinFreeSpace int64 // 上传后磁盘至少保留的剩余字节数
+}
+
+// ParseUploadLimits 解析配置文件中的上传限制
+//
+// 参数：
+//   - config: 上传配置
+//
+// 返回：
+//   - 上传限制
+//   - 错误信息
+func ParseUploadLimits(config UploadConfig) (UploadLimits, error) {
+	var limits UploadLimits
+	var err error
+	if limits.MaxSize, err = ParseSize(config.MaxSize); err != nil {
+		return limits, err
+	}
+	if limits.Quota, err = ParseSize(config.Quota); err != nil {
+		return limits, err
+	}
+	if limits.MinFreeSpace, err = ParseSize(config.MinFreeSpace); err != nil {
+		return limits, err
+	}
+	return limits, nil
+}
+
+// diskUsage 服务目录已用空间，包括已保存的文件和正在进行的上传占用的空间
+//
+// 已保存的文件定期重新统计，统计时跳过内部文件（未完成的上传），
+// 正在接收的表单上传随数据到达逐步占用空间，分块上传会话在存在期间占用其完整大小，
+// 并发的上传合计不会超出存储配额；所有修改都在锁定状态下进行，不会与重新统计交错
+type diskUsage struct {
+	files    int64            // 服务目录中已保存文件的字节数
+	updated  time.Time        // 上次统计的时间
+	reserved int64            // 正在接收的表单上传和 PUT 上传已占用的字节数
+	sessions map[string]int64 // 分块上传会话 ID 到文件大小，首次使用时从会话元数据文件中读取
+	mutex    sync.Mutex       // 互斥锁，控制对统计结果的并发访问
+}
+
+// used 返回服务目录已用空间，需要在锁定状态下调用，缓存过期时重新统计已保存的文件
+//
+// 参数：
+//   - fs: HTTP 文件服务
+//
+// 返回：
+//   - 已用字节数
+//   - 错误信息
+func (u *diskUsage) used(fs *FileServer) (int64, error) {
+	if u.sessions == nil {
+		u.sessions = fs.chunkSessionSizes()
+	}
+	if u.updated.IsZero() || time.Since(u.updated) >= usageCacheDuration {
+		files, err := directorySize(fs.options.Dir)
+		if err != nil {
+			return 0, err
+		}
+		u.files, u.updated = files, time.Now()
+	}
+	total := u.files + u.reserved
+	for _, size := range u.sessions {
+		total += size
+	}
+	return total, nil
+}
+
+// directorySize 统计目录中普通文件的总字节数，跳过内部文件和目录
+//
+// 参数：
+//   - dir: 目录
+//
+// 返回：
+//   - 总字节数
+//   - 错误信息
+func directorySize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // 跳过无法读取的文件和目录
+		}
+		if filePath != dir && IsInternalName(entry.Name()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if fileInfo, err := entry.Info(); err == nil {
+				total += fileInfo.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
+
+// quotaEnabled 判断是否设置了存储配额，未设置时不统计已用空间
+//
+// 返回：
+//   - 是否设置了存储配额
+func (fs *FileServer) quotaEnabled() bool {
+	return fs.options.Limits.Quota > 0
+}
+
+// reserveSession 为分块上传会话占用其完整大小，会话已占用时直接返回
+//
+// 参数：
+//   - id: 会话 ID
+//   - size: 文件大小
+//
+// 返回：
+//   - 错误信息，超出存储配额时为 ErrQuotaExceeded
+func (fs *FileServer) reserveSession(id string, size int64) error {
+	if !fs.quotaEnabled() {
+		return nil
+	}
+	fs.usage.mutex.Lock()
+	defer fs.usage.mutex.Unlock()
+	used, err := fs.usage.used(fs)
+	if err != nil {
+		return err
+	}
+	if _, ok := fs.usage.sessions[id]; ok {
+		return nil
+	}
+	if used+size > fs.options.Limits.Quota {
+		return ErrQuotaExceeded
+	}
+	fs.usage.sessions[id] = size
+	return nil
+}
+
+// releaseSession 释放分块上传会话占用的空间
+//
+// 参数：
+//   - id: 会话 ID
+func (fs *FileServer) releaseSession(id string) {
+	if !fs.quotaEnabled() {
+		return
+	}
+	fs.usage.mutex.Lock()
+	defer fs.usage.mutex.Unlock()
+	delete(fs.usage.sessions, id)
+}
+
+// commitUpload 将接收完毕的文件移动到目标位置，成功后将其占用的空间计入已保存的文件
+//
+// 覆盖已有文件时减去被覆盖文件的大小
+//
+// 参数：
+//   - reservation: 文件接收期间占用的空间，分块上传时为 nil
+//   - sessionID: 分块上传会话 ID，会话占用的空间在移动后释放
+//   - sourcePath: 接收完毕的文件路径
+//   - targetPath: 目标文件路径
+//   - size: 文件大小
+//
+// 返回：
+//   - 实际保存的文件路径
+//   - 错误信息
+func (fs *FileServer) commitUpload(reservation *quotaReservation, sessionID, sourcePath, targetPath string, size int64) (string, error) {
+	if !fs.quotaEnabled() {
+		return commitUploadFile(sourcePath, targetPath, fs.options.OnConflict)
+	}
+	fs.usage.mutex.Lock()
+	defer fs.usage.mutex.Unlock()
+	var replaced int64
+	if fs.options.OnConflict == ConflictOverwrite {
+		if fileInfo, err := os.Lstat(targetPath); err == nil && fileInfo.Mode().IsRegular() {
+			replaced = fileInfo.Size()
+		}
+	}
+	finalPath, err := commitUploadFile(sourcePath, targetPath, fs.options.OnConflict)
+	if err != nil {
+		return "", err
+	}
+	if reservation != nil {
+		fs.usage.reserved -= reservation.bytes
+		reservation.bytes = 0
+	}
+	delete(fs.usage.sessions, sessionID)
+	fs.usage.files += size - replaced
+	return finalPath, nil
+}
+
+// removeAll 删除文件或目录，并从已用空间中减去被删除文件的大小
+//
+// 参数：
+//   - targetPath: 文件或目录路径
+//
+// 返回：
+//   - 错误信息
+func (fs *FileServer) removeAll(targetPath string) error {
+	if !fs.quotaEnabled() {
+		return os.RemoveAll(targetPath)
+	}
+	fs.usage.mutex.Lock()
+	defer fs.usage.mutex.Unlock()
+	// 先完成缓存过期时的重新统计，避免删除前后的统计结果混用
+	if _, err := fs.usage.used(fs); err != nil {
+		return err
+	}
+	before, _ := pathSize(targetPath)
+	err := os.RemoveAll(targetPath)
+	after, _ := pathSize(targetPath)
+	if fs.usage.files -= before - after; fs.usage.files < 0 {
+		fs.usage.files = 0
+	}
+	return err
+}
+
+// pathSize 统计文件或目录的总字节数，与 directorySize 一样只计入普通文件并跳过内部文件
+//
+// 参数：
+//   - targetPath: 文件或目录路径
+//
+// 返回：
+//   - 总字节数，不存在时为 0
+//   - 错误信息
+func pathSize(targetPath string) (int64, error) {
+	fileInfo, err := os.Lstat(targetPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if fileInfo.IsDir() {
+		return directorySize(targetPath)
+	}
+	if fileInfo.Mode().IsRegular() && !IsInternalName(fileInfo.Name()) {
+		return fileInfo.Size(), nil
+	}
+	return 0, nil
+}
+
+// quotaReservation 表单上传和 PUT 上传在接收期间占用的空间
+type quotaReservation struct {
+	fs    *FileServer // HTTP 文件服务
+	bytes int64       // 已占用的字节数
+}
+
+// newReservation 为一次上传创建空间占用，未设置存储配额时返回 nil
+//
+// 返回：
+//   - 空间占用
+func (fs *FileServer) newReservation() *quotaReservation {
+	if !fs.quotaEnabled() {
+		return nil
+	}
+	return &quotaReservation{fs: fs}
+}
+
+// reserve 随数据到达占用空间
+//
+// 参数：
+//   - bytes: 新到达的字节数
+//
+// 返回：
+//   - 错误信息，超出存储配额时为 ErrQuotaExceeded
+func (q *quotaReservation) reserve(bytes int64) error {
+	usage := &q.fs.usage
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+	used, err := usage.used(q.fs)
+	if err != nil {
+		return err
+	}
+	if used+bytes > q.fs.options.Limits.Quota {
+		return ErrQuotaExceeded
+	}
+	usage.reserved += bytes
+	q.bytes += bytes
+	return nil
+}
+
+// release 释放未保存的上传占用的空间，上传已保存时不做任何操作
+func (q *quotaReservation) release() {
+	if q == nil {
+		return
+	}
+	usage := &q.fs.usage
+	usage.mutex.Lock()
+	defer usage.mutex.Unlock()
+	usage.reserved -= q.bytes
+	q.bytes = 0
+}
+
+// reader 读取数据时占用空间，超出存储配额时返回 ErrQuotaExceeded
+//
+// 参数：
+//   - reader: 上传内容
+//
+// 返回：
+//   - 占用空间的上传内容
+func (q *quotaReservation) reader(reader io.Reader) io.Reader {
+	if q == nil {
+		return reader
+	}
+	return &reservingReader{reader: reader, reservation: q}
+}
+
+// reservingReader 读取数据时占用空间
+type reservingReader struct {
+	reader      io.Reader         // 数据来源
+	reservation *quotaReservation // 空间占用
+}
+
+// Read 读取数据
+//
+// 参数：
+//   - p: 缓冲区
+//
+// 返回：
+//   - 读取的字节数
+//   - 错误信息
+func (r *reservingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if reserveErr := r.reservation.reserve(int64(n)); reserveErr != nil {
+			return 0, reserveErr
+		}
+	}
+	return n, err
+}
+
+// uploadLimit 一次上传最多可以接收的字节数
+type uploadLimit struct {
+	remaining int64 // 最多可以接收的字节数，小于 0 时不限制
+	err       error // 超出时返回的错误
+}
+
+// uploadAllowance 检查上传是否超出限制
+//
+// 参数：
+//   - size: 上传的字节数，未知时为 -1
+//   - reserved: 已计入已用空间的字节数，例如分块上传会话占用的空间
+//
+// 返回：
+//   - 最多可以接收的字节数，用于限制大小未知或不可信的上传
+//   - 错误信息，超出限制时为 ErrUploadTooLarge、ErrQuotaExceeded 或 ErrInsufficientSpace
+func (fs *FileServer) uploadAllowance(size, reserved int64) (uploadLimit, error) {
+	limit := uploadLimit{remaining: -1}
+	apply := func(available int64, err error) error {
+		if available < 0 {
+			available = 0
+		}
+		if size > available {
+			return err
+		}
+		if limit.remaining < 0 || available < limit.remaining {
+			limit = uploadLimit{remaining: available, err: err}
+		}
+		return nil
+	}
+
+	limits := fs.options.Limits
+	if limits.MaxSize > 0 {
+		if err := apply(limits.MaxSize, ErrUploadTooLarge); err != nil {
+			return limit, err
+		}
+	}
+	if fs.quotaEnabled() {
+		fs.usage.mutex.Lock()
+		used, err := fs.usage.used(fs)
+		fs.usage.mutex.Unlock()
+		if err != nil {
+			return limit, err
+		}
+		if err := apply(limits.Quota-used+reserved, ErrQuotaExceeded); err != nil {
+			return limit, err
+		}
+	}
+	// 无法获取剩余空间时（例如不支持的文件系统）不做检查
+	if free, err := freeDiskSpace(fs.options.Dir); err == nil {
+		if err := apply(free-limits.MinFreeSpace, ErrInsufficientSpace); err != nil {
+			return limit, err
+		}
+	}
+	return limit, nil
+}
+
+// reader 限制从 reader 读取的字节数，超出时返回对应的错误
+//
+// 参数：
+//   - reader: 上传内容
+//
+// 返回：
+//   - 受限制的上传内容
+func (l uploadLimit) reader(reader io.Reader) io.Reader {
+	if l.remaining < 0 {
+		return reader
+	}
+	return &limitedReader{reader: reader, remaining: l.remaining, err: l.err}
+}
+
+// limitedReader 最多读取 remaining 个字节，之后还有数据时返回 err
+type limitedReader struct {
+	reader    io.Reader // 数据来源
+	remaining int64     // 剩余可读取的字节数
+	err       error     // 超出时返回的错误
+}
+
+// Read 读取数据
+//
+// 参数：
+//   - p: 缓冲区
+//
+// 返回：
+//   - 读取的字节数
+//   - 错误信息
+func (l *limitedReader) Read(p []byte) (int, error) {
+	// 多读取一个字节，用于判断数据是否超出
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.reader.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		return n, l.err
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,280 @@
+/*
+File: define_quota_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-28 10:12:46
+
+Description: 存储配额的测试
+*/
+
+package general
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testQuota 测试中使用的存储配额
+const testQuota = 100 << 10
+
+// newQuotaFileServer 创建设置了存储配额的 HTTP 文件服务
+//
+// 参数：
+//   - t: 测试
+//
+// 返回：
+//   - HTTP 文件服务
+func newQuotaFileServer(t *testing.T) *FileServer {
+	return newTestFileServer(t, ServerOptions{
+		Permissions: Permissions{Read: true, Upload: true, Delete: true},
+		Limits:      UploadLimits{Quota: testQuota},
+	})
+}
+
+// gatedReader 第一次读取时等待 gate 关闭，使多个上传同时通过上传前的检查
+type gatedReader struct {
+	gate   <-chan struct{} // 关闭后开始读取
+	reader io.Reader       // 数据来源
+}
+
+// Read 读取数据
+//
+// 参数：
+//   - p: 缓冲区
+//
+// 返回：
+//   - 读取的字节数
+//   - 错误信息
+func (g *gatedReader) Read(p []byte) (int, error) {
+	<-g.gate
+	return g.reader.Read(p)
+}
+
+// putFile 以 PUT 请求上传文件
+//
+// 参数：
+//   - fileServer: HTTP 文件服务
+//   - name: 文件路径
+//   - body: 文件内容
+//   - size: 文件大小
+//
+// 返回：
+//   - 响应
+func putFile(fileServer *FileServer, name string, body io.Reader, size int64) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPut, "/api/v1/upload?path="+url.QueryEscape(name), body)
+	request.ContentLength = size
+	recorder := httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+// chunkRequest 发送分块上传请求
+//
+// 参数：
+//   - fileServer: HTTP 文件服务
+//   - method: 请求方法
+//   - target: 请求路径
+//   - body: 请求体，可以为 nil
+//
+// 返回：
+//   - 响应
+//   - 解析后的会话
+func chunkRequest(fileServer *FileServer, method, target string, body []byte) (*httptest.ResponseRecorder, ChunkResponse) {
+	request := httptest.NewRequest(method, target, bytes.NewReader(body))
+	recorder := httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+	var response ChunkResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	return recorder, response
+}
+
+// usedBytes 返回服务统计的已用空间
+//
+// 参数：
+//   - t: 测试
+//   - fileServer: HTTP 文件服务
+//
+// 返回：
+//   - 已用字节数
+func usedBytes(t *testing.T, fileServer *FileServer) int64 {
+	t.Helper()
+	fileServer.usage.mutex.Lock()
+	defer fileServer.usage.mutex.Unlock()
+	used, err := fileServer.usage.used(fileServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return used
+}
+
+func TestQuotaConcurrentUploads(t *testing.T) {
+	fileServer := newQuotaFileServer(t)
+	const uploads, size = 8, 30 << 10
+
+	// 所有上传都在开始接收数据之前通过检查，只能依靠接收期间的占用限制总量
+	gate := make(chan struct{})
+	recorders := make([]*httptest.ResponseRecorder, uploads)
+	var wait sync.WaitGroup
+	for index := 0; index < uploads; index++ {
+		wait.Add(1)
+		go func(index int) {
+			defer wait.Done()
+			body := &gatedReader{gate: gate, reader: bytes.NewReader(make([]byte, size))}
+			recorders[index] = putFile(fileServer, "file"+strconv.Itoa(index)+".bin", body, size)
+		}(index)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(gate)
+	wait.Wait()
+
+	succeeded := 0
+	for index, recorder := range recorders {
+		switch recorder.Code {
+		case http.StatusCreated:
+			succeeded++
+		case http.StatusInsufficientStorage:
+		default:
+			t.Errorf("Upload %d: status = %d: %s", index, recorder.Code, recorder.Body)
+		}
+	}
+	saved, err := directorySize(fileServer.options.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if succeeded == 0 || saved != int64(succeeded*size) || saved > testQuota {
+		t.Errorf("Succeeded = %d, saved %d bytes with a quota of %d", succeeded, saved, testQuota)
+	}
+	// 失败的上传释放其占用的空间，统计结果与磁盘上的文件一致
+	if used := usedBytes(t, fileServer); used != saved {
+		t.Errorf("Used = %d, want %d", used, saved)
+	}
+	if entries, _ := os.ReadDir(fileServer.options.Dir); len(entries) != succeeded {
+		t.Errorf("Temporary files were left behind: %d entries", len(entries))
+	}
+}
+
+func TestQuotaChunkSessions(t *testing.T) {
+	fileServer := newQuotaFileServer(t)
+	const size = 60 << 10
+	create := func(name string) (*httptest.ResponseRecorder, ChunkResponse) {
+		return chunkRequest(fileServer, http.MethodPost, "/upload/chunk?path="+name+"&size="+strconv.Itoa(size)+"&key=1", nil)
+	}
+
+	// 会话在存在期间占用其完整大小，未发送数据的会话也会占用
+	recorder, first := create("a.bin")
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("First session: status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder, _ := create("b.bin"); recorder.Code != http.StatusInsufficientStorage {
+		t.Fatalf("Second session: status = %d, want %d", recorder.Code, http.StatusInsufficientStorage)
+	}
+	// 表单上传也不能使用会话占用的空间
+	if recorder := putFile(fileServer, "c.bin", bytes.NewReader(make([]byte, size)), -1); recorder.Code != http.StatusInsufficientStorage {
+		t.Errorf("Upload during session: status = %d, want %d", recorder.Code, http.StatusInsufficientStorage)
+	}
+
+	// 取消会话后释放占用的空间
+	if recorder, _ := chunkRequest(fileServer, http.MethodDelete, "/upload/chunk/"+first.ID, nil); recorder.Code != http.StatusNoContent {
+		t.Fatalf("Delete session: status = %d", recorder.Code)
+	}
+	recorder, second := create("b.bin")
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Session after cancel: status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	// 会话占用的空间在接收完毕后转为已保存的文件，不重复计算
+	recorder, done := chunkRequest(fileServer, http.MethodPatch, "/upload/chunk/"+second.ID+"?offset=0", make([]byte, size))
+	if recorder.Code != http.StatusOK || !done.Done || done.Result.Error != "" {
+		t.Fatalf("Append: status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if used := usedBytes(t, fileServer); used != size {
+		t.Errorf("Used after upload = %d, want %d", used, size)
+	}
+
+	// 未完成的会话在重新统计时也按完整大小计算
+	recorder, third := chunkRequest(fileServer, http.MethodPost, "/upload/chunk?path=d.bin&size=1000&key=1", nil)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Third session: status = %d: %s", recorder.Code, recorder.Body)
+	}
+	chunkRequest(fileServer, http.MethodPatch, "/upload/chunk/"+third.ID+"?offset=0", make([]byte, 500))
+	fileServer.usage.mutex.Lock()
+	fileServer.usage.updated, fileServer.usage.sessions = time.Time{}, nil
+	fileServer.usage.mutex.Unlock()
+	if used := usedBytes(t, fileServer); used != size+1000 {
+		t.Errorf("Used after recount = %d, want %d", used, size+1000)
+	}
+}
+
+func TestQuotaAppendRechecks(t *testing.T) {
+	fileServer := newQuotaFileServer(t)
+	recorder, session := chunkRequest(fileServer, http.MethodPost, "/upload/chunk?path=a.bin&size=40960&key=1", nil)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Create session: status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder, _ := chunkRequest(fileServer, http.MethodPatch, "/upload/chunk/"+session.ID+"?offset=0", make([]byte, 10240)); recorder.Code != http.StatusOK {
+		t.Fatalf("First chunk: status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	// 服务目录被其他程序写入后，继续追加时超出配额
+	if err := os.WriteFile(filepath.Join(fileServer.options.Dir, "other.bin"), make([]byte, 80<<10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileServer.usage.mutex.Lock()
+	fileServer.usage.updated = time.Time{}
+	fileServer.usage.mutex.Unlock()
+	recorder, _ = chunkRequest(fileServer, http.MethodPatch, "/upload/chunk/"+session.ID+"?offset=10240", make([]byte, 30720))
+	if recorder.Code != http.StatusInsufficientStorage {
+		t.Errorf("Second chunk: status = %d, want %d: %s", recorder.Code, http.StatusInsufficientStorage, recorder.Body)
+	}
+	if recorder, state := chunkRequest(fileServer, http.MethodGet, "/upload/chunk/"+session.ID, nil); recorder.Code != http.StatusOK || state.Offset != 10240 {
+		t.Errorf("Session after rejected chunk: status = %d, offset = %d", recorder.Code, state.Offset)
+	}
+}
+
+func TestQuotaDeleteReleasesSpace(t *testing.T) {
+	fileServer := newQuotaFileServer(t)
+	if recorder := putFile(fileServer, "dir/a.bin", bytes.NewReader(make([]byte, 80<<10)), 80<<10); recorder.Code != http.StatusCreated {
+		t.Fatalf("First upload: status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := putFile(fileServer, "b.bin", bytes.NewReader(make([]byte, 30<<10)), 30<<10); recorder.Code != http.StatusInsufficientStorage {
+		t.Fatalf("Upload over quota: status = %d, want %d", recorder.Code, http.StatusInsufficientStorage)
+	}
+
+	// 删除后立即可以使用释放的空间，不必等待重新统计
+	if recorder := postForm(fileServer, "/api/v1/delete", url.Values{"path": {"dir"}}); recorder.Code != http.StatusOK {
+		t.Fatalf("Delete: status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if used := usedBytes(t, fileServer); used != 0 {
+		t.Errorf("Used after delete = %d, want 0", used)
+	}
+	if recorder := putFile(fileServer, "b.bin", bytes.NewReader(make([]byte, 30<<10)), 30<<10); recorder.Code != http.StatusCreated {
+		t.Errorf("Upload after delete: status = %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestQuotaOverwrite(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{
+		Permissions: Permissions{Upload: true},
+		OnConflict:  ConflictOverwrite,
+		Limits:      UploadLimits{Quota: testQuota},
+	})
+	// 覆盖已有文件时减去被覆盖文件的大小，接收期间新旧文件同时占用空间
+	for attempt := 0; attempt < 3; attempt++ {
+		if recorder := putFile(fileServer, "a.bin", bytes.NewReader(make([]byte, 40<<10)), 40<<10); recorder.Code != http.StatusCreated {
+			t.Fatalf("Upload %d: status = %d: %s", attempt, recorder.Code, recorder.Body)
+		}
+	}
+	if used := usedBytes(t, fileServer); used != 40<<10 {
+		t.Errorf("Used = %d, want %d", used, 40<<10)
+	}
+}
@@ -0,0 +1,515 @@
+/*
+File: define_resumable.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-01 09:17:44
+
+Description: 可断点续传的分块上传
+*/
+
+package general
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InternalPrefix 内部文件名前缀，带此前缀的文件和目录不会出现在目录列表中，也不能被下载或上传覆盖
+const InternalPrefix = ".skynet-"
+
+// partialDirName 保存未完成上传的目录名，位于服务目录中
+const partialDirName = InternalPrefix + "uploads"
+
+// chunkSessionMaxAge 未完成的上传超过该时间没有收到数据时，在服务启动时和之后的定期清理中被删除
+const chunkSessionMaxAge = 7 * 24 * time.Hour
+
+// chunkSessionCleanupInterval 服务运行期间清理被放弃的上传的间隔
+var chunkSessionCleanupInterval = time.Hour
+
+// ChunkSession 分块上传会话
+type ChunkSession struct {
+	ID       string `json:"id"`                 // 会话 ID
+	Path     string `json:"path"`               // 文件相对于服务目录的路径
+	Size     int64  `json:"size"`               // 文件大小（字节）
+	Offset   int64  `json:"offset"`             // 已接收的字节数
+	Checksum string `json:"checksum,omitempty"` // 创建会话时客户端在 X-Checksum 头中提供的 SHA-256 校验和，接收完毕后校验
+}
+
+// ChunkResponse 分块上传请求的响应
+type ChunkResponse struct {
+	ChunkSession
+	Done   bool          `json:"done"`             // 是否已接收完毕
+	Result *UploadResult `json:"result,omitempty"` // 接收完毕后的上传结果
+}
+
+// chunkLocks 分块上传会话锁，防止同一会话的请求并发写入
+type chunkLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock 锁定会话
+//
+// 参数：
+//   - id: 会话 ID
+//
+// 返回：
+//   - 解锁函数
+func (cl *chunkLocks) lock(id string) func() {
+	cl.mutex.Lock()
+	if cl.locks == nil {
+		cl.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := cl.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		cl.locks[id] = lock
+	}
+	cl.mutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// IsInternalName 判断文件名是否是内部文件名
+//
+// 参数：
+//   - name: 文件名
+//
+// 返回：
+//   - 是否是内部文件名
+func IsInternalName(name string) bool {
+	return strings.HasPrefix(name, InternalPrefix)
+}
+
+// hasInternalSegment 判断以 "/" 分隔的路径中是否有内部文件名
+//
+// 参数：
+//   - name: 路径
+//
+// 返回：
+//   - 是否有内部文件名
+func hasInternalSegment(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if IsInternalName(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkSessionID 根据文件信息生成会话 ID
+//
+// 参数：
+//   - relativePath: 文件相对于服务目录的路径
+//   - size: 文件大小
+//   - key: 客户端标识，例如文件的修改时间
+//
+// 返回：
+//   - 会话 ID
+func chunkSessionID(relativePath string, size int64, key string) string {
+	sum := sha256.Sum256([]byte(relativePath + "\x00" + strconv.FormatInt(size, 10) + "\x00" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// isChunkSessionID 判断是否是合法的会话 ID，防止 ID 被用来构造路径
+//
+// 参数：
+//   - id: 会话 ID
+//
+// 返回：
+//   - 是否合法
+func isChunkSessionID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// partialPaths 返回会话的数据文件和元数据文件路径
+//
+// 参数：
+//   - id: 会话 ID
+//
+// 返回：
+//   - 数据文件路径
+//   - 元数据文件路径
+func (fs *FileServer) partialPaths(id string) (string, string) {
+	dir := filepath.Join(fs.options.Dir, partialDirName)
+	return filepath.Join(dir, id+".part"), filepath.Join(dir, id+".json")
+}
+
+// loadChunkSession 读取会话，已接收的字节数以数据文件大小为准
+//
+// 参数：
+//   - id: 会话 ID
+//
+// 返回：
+//   - 会话
+//   - 错误信息
+func (fs *FileServer) loadChunkSession(id string) (*ChunkSession, error) {
+	if !isChunkSessionID(id) {
+		return nil, os.ErrNotExist
+	}
+	dataPath, metaPath := fs.partialPaths(id)
+	content, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	session := &ChunkSession{}
+	if err := json.Unmarshal(content, session); err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	session.ID = id
+	session.Offset = fileInfo.Size()
+	return session, nil
+}
+
+// removeChunkSession 删除会话的数据文件和元数据文件，并释放会话占用的存储配额
+//
+// 参数：
+//   - id: 会话 ID
+func (fs *FileServer) removeChunkSession(id string) {
+	dataPath, metaPath := fs.partialPaths(id)
+	os.Remove(dataPath)
+	os.Remove(metaPath)
+	fs.releaseSession(id)
+}
+
+// chunkSessionSizes 读取所有会话的文件大小，用于统计会话占用的存储配额
+//
+// 返回：
+//   - 会话 ID 到文件大小的映射
+func (fs *FileServer) chunkSessionSizes() map[string]int64 {
+	sizes := make(map[string]int64)
+	entries, _ := os.ReadDir(filepath.Join(fs.options.Dir, partialDirName))
+	for _, entry := range entries {
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		if id == entry.Name() || !isChunkSessionID(id) {
+			continue
+		}
+		_, metaPath := fs.partialPaths(id)
+		content, err := os.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+		var session ChunkSession
+		if json.Unmarshal(content, &session) == nil {
+			sizes[id] = session.Size
+		}
+	}
+	return sizes
+}
+
+// removeStaleChunkSessions 删除超过指定时间没有收到数据的会话，避免被放弃的上传一直占用磁盘空间和存储配额
+//
+// 参数：
+//   - maxAge: 会话最后一次收到数据后保留的时间
+func (fs *FileServer) removeStaleChunkSessions(maxAge time.Duration) {
+	entries, err := os.ReadDir(filepath.Join(fs.options.Dir, partialDirName))
+	if err != nil {
+		return
+	}
+
+	// 数据文件在每次收到数据时更新，元数据文件只在创建会话时写入，以两者中较新的修改时间为准
+	lastModified := make(map[string]time.Time)
+	for _, entry := range entries {
+		id := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".part"), ".json")
+		fileInfo, err := entry.Info()
+		if err != nil || !isChunkSessionID(id) {
+			continue
+		}
+		if modTime := fileInfo.ModTime(); modTime.After(lastModified[id]) {
+			lastModified[id] = modTime
+		}
+	}
+	for id, modTime := range lastModified {
+		if time.Since(modTime) > maxAge {
+			unlock := fs.chunkLocks.lock(id)
+			fs.removeChunkSession(id)
+			unlock()
+		}
+	}
+}
+
+// handleChunkUpload 处理分块上传请求
+//
+// 协议：
+//   - POST /upload/chunk?path=<相对路径>&size=<文件大小>&key=<客户端标识>: 创建或恢复会话，返回会话 ID 和已接收的字节数
+//   - GET /upload/chunk/<ID>: 查询会话已接收的字节数
+//   - PATCH /upload/chunk/<ID>?offset=<偏移量>: 从偏移量处追加请求体，接收完毕后将文件移动到目标位置
+//   - DELETE /upload/chunk/<ID>: 取消上传，删除已接收的部分
+//
+// 同一文件（相同的路径、大小和客户端标识）总是得到相同的会话 ID，连接中断后客户端查询偏移量即可继续上传
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleChunkUpload(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/upload/chunk"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		fs.createChunkSession(w, r)
+	case id != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		unlock := fs.chunkLocks.lock(id)
+		session, err := fs.loadChunkSession(id)
+		unlock()
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ChunkResponse{ChunkSession: *session})
+	case id != "" && r.Method == http.MethodPatch:
+		fs.appendChunk(w, r, id)
+	case id != "" && r.Method == http.MethodDelete:
+		unlock := fs.chunkLocks.lock(id)
+		_, err := fs.loadChunkSession(id)
+		if err == nil {
+			fs.removeChunkSession(id)
+		}
+		unlock()
+		if err != nil {
+			writeJSONError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, PATCH, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed"})
+	}
+}
+
+// createChunkSession 创建或恢复分块上传会话
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) createChunkSession(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	size, err := strconv.ParseInt(query.Get("size"), 10, 64)
+	if err != nil || size < 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid size"})
+		return
+	}
+	relativePath, targetPath, err := ResolveUploadPath(fs.options.Dir, query.Get("path"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	// 拒绝策略下同名文件已存在时不必接收文件内容
+	if fs.options.OnConflict == ConflictReject && FileExist(targetPath) {
+		status, message := operationErrorStatus(ErrFileExists)
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+	checksum, err := ParseChecksum(r.Header.Get(ChecksumHeader))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	id := chunkSessionID(relativePath, size, query.Get("key"))
+	unlock := fs.chunkLocks.lock(id)
+	defer unlock()
+
+	// 会话已存在则直接返回已接收的字节数
+	if session, err := fs.loadChunkSession(id); err == nil {
+		writeJSON(w, http.StatusOK, ChunkResponse{ChunkSession: *session})
+		return
+	}
+
+	// 文件大小已知，创建新会话前检查上传限制，会话存在期间占用其完整大小的存储配额
+	_, err = fs.uploadAllowance(size, 0)
+	if err == nil {
+		err = fs.reserveSession(id, size)
+	}
+	if err != nil {
+		status, message := operationErrorStatus(err)
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+
+	session := ChunkSession{ID: id, Path: relativePath, Size: size, Checksum: checksum}
+	dataPath, metaPath := fs.partialPaths(id)
+	if err := os.MkdirAll(filepath.Dir(dataPath), os.ModePerm); err != nil {
+		fs.releaseSession(id)
+		writeJSONError(w, err)
+		return
+	}
+	content, _ := json.Marshal(session)
+	err = os.WriteFile(metaPath, content, 0666)
+	if err == nil {
+		err = os.WriteFile(dataPath, nil, 0666)
+	}
+	if err != nil {
+		fs.removeChunkSession(id)
+		writeJSONError(w, err)
+		return
+	}
+
+	// 空文件无需再发送数据
+	if size == 0 {
+		result := fs.finishChunkSession(&session)
+		writeJSON(w, http.StatusCreated, ChunkResponse{ChunkSession: session, Done: true, Result: &result})
+		return
+	}
+	writeJSON(w, http.StatusCreated, ChunkResponse{ChunkSession: session})
+}
+
+// appendChunk 从指定偏移量处追加数据，接收完毕后将文件移动到目标位置
+//
+// 连接中断时已接收的部分会被保留，客户端重新查询偏移量后继续上传
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+//   - id: 会话 ID
+func (fs *FileServer) appendChunk(w http.ResponseWriter, r *http.Request, id string) {
+	unlock := fs.chunkLocks.lock(id)
+	defer unlock()
+
+	session, err := fs.loadChunkSession(id)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || offset != session.Offset {
+		// 偏移量不一致，返回当前偏移量让客户端从正确位置继续
+		writeJSON(w, http.StatusConflict, ChunkResponse{ChunkSession: *session})
+		return
+	}
+
+	// 每次追加前重新检查上传限制，会话自身占用的存储配额不重复计算
+	remaining := session.Size - session.Offset
+	err = fs.reserveSession(id, session.Size)
+	var limit uploadLimit
+	if err == nil {
+		limit, err = fs.uploadAllowance(remaining, session.Size)
+	}
+	if err != nil {
+		status, message := operationErrorStatus(err)
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+
+	dataPath, _ := fs.partialPaths(id)
+	dataFile, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	defer fs.transfers.begin()()
+	written, copyErr := io.Copy(dataFile, limit.reader(io.LimitReader(r.Body, remaining)))
+	if copyErr == nil && session.Offset+written == session.Size {
+		// 接收完毕，移动到目标位置前确保数据已写入磁盘
+		copyErr = dataFile.Sync()
+	}
+	closeErr := dataFile.Close()
+	session.Offset += written
+	if copyErr != nil || closeErr != nil {
+		// 连接中断或超出上传限制，已写入的部分保留用于续传
+		fs.transfers.addUpload(written, false)
+		if errors.Is(copyErr, limit.err) {
+			status, message := operationErrorStatus(copyErr)
+			writeJSON(w, status, map[string]string{"error": message})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, ChunkResponse{ChunkSession: *session})
+		return
+	}
+
+	if session.Offset < session.Size {
+		fs.transfers.addReceived(written)
+		writeJSON(w, http.StatusOK, ChunkResponse{ChunkSession: *session})
+		return
+	}
+	result := fs.finishChunkSession(session)
+	fs.transfers.addUpload(written, result.Error == "")
+	writeJSON(w, http.StatusOK, ChunkResponse{ChunkSession: *session, Done: true, Result: &result})
+}
+
+// finishChunkSession 将接收完毕的文件按同名文件处理策略移动到目标位置，并删除会话
+//
+// 参数：
+//   - session: 会话
+//
+// 返回：
+//   - 上传结果
+func (fs *FileServer) finishChunkSession(session *ChunkSession) UploadResult {
+	defer fs.removeChunkSession(session.ID)
+	result := UploadResult{Name: session.Path, Size: session.Size}
+
+	relativePath, targetPath, err := ResolveUploadPath(fs.options.Dir, session.Path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := os.MkdirAll(filepath.Dir(targetPath), os.ModePerm); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	dataPath, _ := fs.partialPaths(session.ID)
+	if result.SHA256, err = FileChecksum(dataPath); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if session.Checksum != "" && result.SHA256 != session.Checksum {
+		result.Error = ErrChecksumMismatch.Error()
+		return result
+	}
+	finalPath, err := fs.commitUpload(nil, session.ID, dataPath, targetPath, result.Size)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Name = path.Join(path.Dir(relativePath), filepath.Base(finalPath))
+	fs.cacheChecksum(result.Name, finalPath, result.SHA256)
+	return result
+}
+
+// writeJSON 以 JSON 格式输出响应
+//
+// 参数：
+//   - w: 响应
+//   - status: 状态码
+//   - data: 响应数据
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// writeJSONError 根据错误类型以 JSON 格式输出错误响应
+//
+// 参数：
+//   - w: 响应
+//   - err: 错误信息
+func writeJSONError(w http.ResponseWriter, err error) {
+	// 不向客户端暴露服务目录的绝对路径
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Not found"})
+	case errors.Is(err, os.ErrPermission):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "Permission denied"})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+}
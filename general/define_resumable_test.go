@@ -0,0 +1,126 @@
+/*
+File: define_resumable_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-26 14:36:08
+
+Description: 分块上传的测试
+*/
+
+package general
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestChunkSessionRejectsExistingTarget(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{OnConflict: ConflictReject})
+	if err := os.WriteFile(filepath.Join(fileServer.options.Dir, "a.bin"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/upload/chunk?path=a.bin&size=1048576&key=1", nil)
+	recorder := httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("Status = %d, want %d: %s", recorder.Code, http.StatusConflict, recorder.Body)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(fileServer.options.Dir, partialDirName)); len(entries) != 0 {
+		t.Errorf("Session was created for a rejected upload: %v", entries)
+	}
+
+	// 目标不存在时正常创建会话
+	request = httptest.NewRequest(http.MethodPost, "/upload/chunk?path=b.bin&size=1048576&key=1", nil)
+	recorder = httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("Status = %d, want %d: %s", recorder.Code, http.StatusCreated, recorder.Body)
+	}
+}
+
+func TestRemoveStaleChunkSessions(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{})
+	create := func(path string) string {
+		request := httptest.NewRequest(http.MethodPost, "/upload/chunk?path="+path+"&size=10&key=1", nil)
+		recorder := httptest.NewRecorder()
+		fileServer.Handler().ServeHTTP(recorder, request)
+		var response ChunkResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || response.ID == "" {
+			t.Fatalf("Unable to create session: %d %v", recorder.Code, err)
+		}
+		return response.ID
+	}
+	stale, fresh, touched := create("stale.bin"), create("fresh.bin"), create("touched.bin")
+
+	old := time.Now().Add(-chunkSessionMaxAge - time.Hour)
+	for _, id := range []string{stale, touched} {
+		dataPath, metaPath := fileServer.partialPaths(id)
+		os.Chtimes(metaPath, old, old)
+		if id == stale {
+			os.Chtimes(dataPath, old, old)
+		}
+	}
+	fileServer.removeStaleChunkSessions(chunkSessionMaxAge)
+
+	for id, want := range map[string]bool{stale: false, fresh: true, touched: true} {
+		if _, err := fileServer.loadChunkSession(id); (err == nil) != want {
+			t.Errorf("Session %s exists = %v, want %v", id, err == nil, want)
+		}
+	}
+	if dataPath, metaPath := fileServer.partialPaths(stale); FileExist(dataPath) || FileExist(metaPath) {
+		t.Errorf("Files of the stale session were not removed")
+	}
+}
+
+func TestChunkSessionCleanupWhileRunning(t *testing.T) {
+	interval := chunkSessionCleanupInterval
+	chunkSessionCleanupInterval = 10 * time.Millisecond
+	defer func() { chunkSessionCleanupInterval = interval }()
+
+	fileServer := newTestFileServer(t, ServerOptions{Address: "127.0.0.1", Port: "0"})
+	if err := fileServer.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stale := func() (string, string) {
+		request := httptest.NewRequest(http.MethodPost, "/upload/chunk?path=a.bin&size=10&key="+strconv.FormatInt(time.Now().UnixNano(), 10), nil)
+		recorder := httptest.NewRecorder()
+		fileServer.Handler().ServeHTTP(recorder, request)
+		var response ChunkResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || response.ID == "" {
+			t.Fatalf("Unable to create session: %d %v", recorder.Code, err)
+		}
+		old := time.Now().Add(-chunkSessionMaxAge - time.Hour)
+		dataPath, metaPath := fileServer.partialPaths(response.ID)
+		os.Chtimes(dataPath, old, old)
+		os.Chtimes(metaPath, old, old)
+		return dataPath, metaPath
+	}
+
+	// 服务运行期间过期的会话被定期清理
+	dataPath, metaPath := stale()
+	deadline := time.Now().Add(5 * time.Second)
+	for FileExist(dataPath) || FileExist(metaPath) {
+		if time.Now().After(deadline) {
+			t.Fatal("Stale session was not removed while the server was running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 服务结束后不再清理
+	if err := fileServer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dataPath, metaPath = stale()
+	time.Sleep(100 * time.Millisecond)
+	if !FileExist(dataPath) || !FileExist(metaPath) {
+		t.Error("Session was removed after the server was shut down")
+	}
+}
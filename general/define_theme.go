@@ -0,0 +1,136 @@
+/*
+File: define_theme.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-16 09:27:35
+
+Description: 页面模板和静态资源，支持使用主题目录覆盖
+*/
+
+package general
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// webFiles 内置的页面模板和静态资源
+//
+//go:embed web
+var webFiles embed.FS
+
+// pageNames 页面模板名称，每个页面对应 web 目录中的同名 .html 文件，与 layout.html 组合渲染
+var pageNames = []string{"index", "download", "upload", "result"}
+
+// themeFS 优先从主题目录读取文件，主题目录中不存在的文件使用内置文件
+type themeFS struct {
+	theme fs.FS // 主题目录，为 nil 时只使用内置文件
+	base  fs.FS // 内置文件
+}
+
+// Open 打开文件
+//
+// 参数：
+//   - name: 文件名
+//
+// 返回：
+//   - 文件
+//   - 错误信息
+func (t themeFS) Open(name string) (fs.File, error) {
+	if t.theme != nil {
+		if file, err := t.theme.Open(name); err == nil {
+			return file, nil
+		}
+	}
+	return t.base.Open(name)
+}
+
+// loadTheme 加载页面模板和静态资源
+//
+// 主题目录中可以放置 layout.html、index.html、download.html、upload.html、result.html
+// 以及 static 目录中的任意文件，同名文件覆盖内置文件
+//
+// 参数：
+//   - themeDir: 主题目录，为空时只使用内置文件
+//
+// 返回：
+//   - 页面模板，键为页面名称
+//   - 静态资源处理器
+//   - 错误信息
+func loadTheme(themeDir string) (map[string]*template.Template, http.Handler, error) {
+	base, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		return nil, nil, err
+	}
+	files := themeFS{base: base}
+	if themeDir != "" {
+		fileInfo, err := os.Stat(themeDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !fileInfo.IsDir() {
+			return nil, nil, fmt.Errorf("Theme directory is not a directory: %s", themeDir)
+		}
+		files.theme = os.DirFS(themeDir)
+	}
+
+	pages := make(map[string]*template.Template, len(pageNames))
+	for _, name := range pageNames {
+		page, err := template.New(name).ParseFS(files, "layout.html", name+".html")
+		if err != nil {
+			return nil, nil, fmt.Errorf("Unable to load page template %s: %w", name, err)
+		}
+		pages[name] = page
+	}
+
+	static, err := fs.Sub(files, "static")
+	if err != nil {
+		return nil, nil, err
+	}
+	fileServer := http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+	staticHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 不列出静态资源目录
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	})
+	return pages, staticHandler, nil
+}
+
+// render 渲染页面
+//
+// 先渲染到缓冲区，模板出错时返回 500 而不是输出不完整的页面
+//
+// 参数：
+//   - w: 响应
+//   - name: 页面名称
+//   - data: 页面数据
+func (fs *FileServer) render(w http.ResponseWriter, name string, data map[string]interface{}) {
+	fs.renderStatus(w, http.StatusOK, name, data)
+}
+
+// renderStatus 以指定的状态码渲染页面
+//
+// 参数：
+//   - w: 响应
+//   - status: 状态码
+//   - name: 页面名称
+//   - data: 页面数据
+func (fs *FileServer) renderStatus(w http.ResponseWriter, status int, name string, data map[string]interface{}) {
+	var buffer bytes.Buffer
+	if err := fs.pages[name].ExecuteTemplate(&buffer, "layout", data); err != nil {
+		http.Error(w, "Unable to render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buffer.WriteTo(w)
+}
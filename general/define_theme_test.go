@@ -0,0 +1,106 @@
+/*
+File: define_theme_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-27 14:25:19
+
+Description: 页面模板转义的测试
+*/
+
+package general
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// hostileNames 包含 HTML 和 JavaScript 代码的文件名
+var hostileNames = []string{
+	`<script>alert(1)<\script>.txt`,
+	`<img src=x onerror=alert(2)>.txt`,
+	`"><svg onload=alert(3)>.txt`,
+	`';alert(4);'.txt`,
+}
+
+// assertEscaped 确认页面中没有未转义的恶意代码
+//
+// 参数：
+//   - t: 测试
+//   - page: 页面名称
+//   - body: 页面内容
+func assertEscaped(t *testing.T, page, body string) {
+	t.Helper()
+	for _, raw := range []string{"<script>alert", "<img src=x", "<svg onload", `"><svg`, `"/";alert`, `";alert(5);"`} {
+		if strings.Contains(body, raw) {
+			t.Errorf("%s page contains unescaped %q", page, raw)
+		}
+	}
+}
+
+func TestListingEscapesHostileNames(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{Permissions: Permissions{Read: true, Rename: true, Delete: true}})
+	// 目录名出现在脚本中的字符串里
+	dir := filepath.Join(fileServer.options.Dir, `";alert(5);"`)
+	if err := os.Mkdir(dir, os.ModePerm); err != nil {
+		t.Skipf("File system does not allow the name: %v", err)
+	}
+	for _, name := range hostileNames {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Skipf("File system does not allow the name: %v", err)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/download/"+EscapeURLPath(`";alert(5);"`)+"/", nil)
+	recorder := httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", recorder.Code, recorder.Body)
+	}
+	body := recorder.Body.String()
+	assertEscaped(t, "download", body)
+	if !strings.Contains(body, "&lt;img src=x onerror=alert(2)&gt;.txt") {
+		t.Error("File name is missing from the listing")
+	}
+	// 脚本中的字符串以 JavaScript 的方式转义，引号不能结束字符串
+	if !strings.Contains(body, `var current = "\/\u0022;alert(5);\u0022\/";`) {
+		t.Errorf("Current path is not escaped as a JavaScript string:\n%s", body)
+	}
+}
+
+func TestUploadResultEscapesHostileNames(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{})
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	// 不安全的路径原样出现在失败的上传结果中
+	for _, name := range hostileNames {
+		writer.WriteField("path", "../"+name)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte("x"))
+	}
+	// 成功的上传结果中是清理后的名称
+	for _, name := range hostileNames {
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte("x"))
+	}
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Status = %d: %s", recorder.Code, recorder.Body)
+	}
+	result := recorder.Body.String()
+	assertEscaped(t, "result", result)
+	if !strings.Contains(result, "../&lt;img src=x onerror=alert(2)&gt;.txt: Unsafe path") {
+		t.Errorf("Failed upload is missing from the result:\n%s", result)
+	}
+}
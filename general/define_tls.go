@@ -0,0 +1,129 @@
+/*
+File: define_tls.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-05 09:48:17
+
+Description: HTTPS 证书
+*/
+
+package general
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// certificateValidity 自动生成的证书有效期
+const certificateValidity = 30 * 24 * time.Hour
+
+// LoadCertificate 加载证书，证书和私钥文件都为空时生成临时的自签名证书
+//
+// 参数：
+//   - certFile: PEM 格式的证书文件
+//   - keyFile: PEM 格式的私钥文件
+//   - address: 服务地址，生成证书时作为证书的使用者可选名称
+//
+// 返回：
+//   - 证书
+//   - 错误信息
+func LoadCertificate(certFile, keyFile, address string) (tls.Certificate, error) {
+	switch {
+	case certFile != "" && keyFile != "":
+		return tls.LoadX509KeyPair(certFile, keyFile)
+	case certFile != "" || keyFile != "":
+		return tls.Certificate{}, errors.New("Both certificate and key files must be specified")
+	default:
+		return GenerateCertificate(address)
+	}
+}
+
+// GenerateCertificate 生成临时的自签名证书，私钥只保存在内存中
+//
+// 证书的使用者可选名称包含 localhost、主机名、服务地址以及服务地址为 0.0.0.0 时本机所有网卡的 IP
+//
+// 参数：
+//   - address: 服务地址
+//
+// 返回：
+//   - 证书
+//   - 错误信息
+func GenerateCertificate(address string) (tls.Certificate, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"skynet"}, CommonName: "skynet"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	ip := net.ParseIP(address)
+	switch {
+	case ip == nil && address != "":
+		template.DNSNames = append(template.DNSNames, address)
+	case ip == nil || ip.IsUnspecified():
+		// 监听所有网卡时将本机所有 IP 加入证书
+		if addrs, err := net.InterfaceAddrs(); err == nil {
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
+					template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+				}
+			}
+		}
+	case !ip.IsLoopback():
+		template.IPAddresses = append(template.IPAddresses, ip)
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{certDER}, PrivateKey: privateKey}, nil
+}
+
+// CertificateFingerprint 计算证书的 SHA-256 指纹
+//
+// 参数：
+//   - certificate: 证书
+//
+// 返回：
+//   - 以 ":" 分隔的大写十六进制指纹，例如 "AB:CD:..."，证书为空时返回空字符串
+func CertificateFingerprint(certificate tls.Certificate) string {
+	if len(certificate.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(certificate.Certificate[0])
+	parts := make([]string, len(sum))
+	for index, value := range sum {
+		parts[index] = fmt.Sprintf("%02X", value)
+	}
+	return strings.Join(parts, ":")
+}
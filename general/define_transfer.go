@@ -0,0 +1,129 @@
+/*
+File: define_transfer.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-20 14:36:08
+
+Description: 统计文件传输，关闭服务时等待进行中的传输结束
+*/
+
+package general
+
+import (
+	"fmt"
+	"sync"
+)
+
+// TransferSummary 服务运行期间的传输统计
+type TransferSummary struct {
+	Downloads     int64 // 完成的下载数（包括打包下载）
+	Uploads       int64 // 完成的上传数
+	Failed        int64 // 失败或被中断的传输数
+	BytesSent     int64 // 下载发送的字节数
+	BytesReceived int64 // 上传接收的字节数
+}
+
+// String 返回传输统计的文本描述
+//
+// 返回：
+//   - 传输统计
+func (s TransferSummary) String() string {
+	return fmt.Sprintf("%d downloads (%s sent), %d uploads (%s received), %d failed",
+		s.Downloads, FormatSize(s.BytesSent), s.Uploads, FormatSize(s.BytesReceived), s.Failed)
+}
+
+// transferTracker 统计传输并记录进行中的传输数
+type transferTracker struct {
+	summary TransferSummary // 传输统计
+	active  int             // 进行中的传输数
+	idle    *sync.Cond      // 进行中的传输数变为 0 时广播
+	mutex   sync.Mutex      // 互斥锁，控制对统计的并发访问
+}
+
+// begin 开始一次传输
+//
+// 返回：
+//   - 结束传输的函数
+func (t *transferTracker) begin() func() {
+	t.mutex.Lock()
+	t.active++
+	t.mutex.Unlock()
+
+	return func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		t.active--
+		if t.active == 0 && t.idle != nil {
+			t.idle.Broadcast()
+		}
+	}
+}
+
+// addDownload 记录一次下载
+//
+// 参数：
+//   - bytes: 发送的字节数
+//   - ok: 是否完成
+func (t *transferTracker) addDownload(bytes int64, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.summary.BytesSent += bytes
+	if ok {
+		t.summary.Downloads++
+	} else {
+		t.summary.Failed++
+	}
+}
+
+// addUpload 记录一次上传
+//
+// 参数：
+//   - bytes: 接收的字节数
+//   - ok: 是否完成
+func (t *transferTracker) addUpload(bytes int64, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.summary.BytesReceived += bytes
+	if ok {
+		t.summary.Uploads++
+	} else {
+		t.summary.Failed++
+	}
+}
+
+// addReceived 记录分块上传中尚未完成的文件接收的字节数
+//
+// 参数：
+//   - bytes: 接收的字节数
+func (t *transferTracker) addReceived(bytes int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.summary.BytesReceived += bytes
+}
+
+// wait 阻塞直到没有进行中的传输
+func (t *transferTracker) wait() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.idle == nil {
+		t.idle = sync.NewCond(&t.mutex)
+	}
+	for t.active > 0 {
+		t.idle.Wait()
+	}
+}
+
+// Transfers 返回服务运行期间的传输统计
+//
+// 返回：
+//   - 传输统计
+func (fs *FileServer) Transfers() TransferSummary {
+	fs.transfers.mutex.Lock()
+	defer fs.transfers.mutex.Unlock()
+	return fs.transfers.summary
+}
@@ -0,0 +1,428 @@
+/*
+File: define_upload.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-07-26 10:03:27
+
+Description: 处理文件上传
+*/
+
+package general
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 上传文件与已有文件同名时的处理策略
+const (
+	ConflictRename    = "rename"    // 重命名为 "name (1).ext" 形式
+	ConflictOverwrite = "overwrite" // 覆盖已有文件
+	ConflictReject    = "reject"    // 拒绝上传
+)
+
+// ConflictPolicies 支持的同名文件处理策略列表
+var ConflictPolicies = []string{ConflictRename, ConflictOverwrite, ConflictReject}
+
+// ErrFileExists 同名文件已存在且策略为拒绝上传
+var ErrFileExists = errors.New("File already exists")
+
+// ErrPathAfterFile 上传表单中的 path 字段出现在其对应的 file 字段之后，该文件已按原文件名保存
+var ErrPathAfterFile = errors.New("Path field must precede its file field")
+
+// maxRenameAttempts 重命名策略下尝试的最大序号
+const maxRenameAttempts = 10000
+
+// ParseConflictPolicy 校验同名文件处理策略，不区分大小写
+//
+// 参数：
+//   - policy: 策略名称
+//
+// 返回：
+//   - 标准策略名称
+//   - 错误信息
+func ParseConflictPolicy(policy string) (string, error) {
+	for _, conflictPolicy := range ConflictPolicies {
+		if strings.EqualFold(conflictPolicy, policy) {
+			return conflictPolicy, nil
+		}
+	}
+	return "", fmt.Errorf("Unsupported conflict policy: %s", policy)
+}
+
+// UploadResult 单个文件的上传结果
+type UploadResult struct {
+	Name   string `json:"name"`             // 文件相对于服务目录的路径
+	Size   int64  `json:"size"`             // 文件大小（字节）
+	SHA256 string `json:"sha256,omitempty"` // 接收到的文件内容的 SHA-256 校验和
+	Error  string `json:"error,omitempty"`  // 错误信息，上传成功时为空
+}
+
+// UploadSummary 一次上传请求的结果汇总
+type UploadSummary struct {
+	Succeeded int            `json:"succeeded"`       // 成功的文件数
+	Failed    int            `json:"failed"`          // 失败的文件数
+	Results   []UploadResult `json:"results"`         // 每个文件的上传结果
+	Error     string         `json:"error,omitempty"` // 表单未能读取完毕时的错误信息，此时 Results 为出错前已处理的文件
+}
+
+// handleUpload 显示文件上传表单（GET）或保存上传的文件（POST）
+//
+// POST 请求中每个 file 字段是一个文件，可选的 path 字段按顺序与 file 字段一一对应，
+// 给出文件相对于服务目录的路径，用于上传目录时还原目录结构；
+// 表单按顺序逐个读取并直接写入目标目录，不在内存或临时目录中缓存，因此 path 字段需要位于对应的 file 字段之前，
+// 否则返回 400 和 ErrPathAfterFile；
+// 表单未能读取完毕时（例如 ErrPathAfterFile 或超出上传限制）返回错误状态码，已处理过文件时同时返回出错前的上传结果，已保存的文件保留；
+// 每个文件可以在其 X-Checksum 头中给出 SHA-256 校验和，第一个文件也可以使用请求的 X-Checksum 头，不一致时上传失败；
+// 请求的 Accept 头包含 application/json 时以 UploadSummary 的 JSON 格式返回结果，否则返回结果页面
+//
+// 参数：
+//   - w: 响应
+//   - r: 请求
+func (fs *FileServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		// 显示文件上传表单
+		fs.render(w, "upload", map[string]interface{}{
+			"Navigation": fs.navigation(),
+		})
+		return
+	}
+
+	// 检查上传限制，读取表单时超出限制的部分不会被接收
+	jsonResponse := wantsJSON(r)
+	limit, err := fs.uploadAllowance(r.ContentLength, 0)
+	if err != nil {
+		status, message := operationErrorStatus(err)
+		uploadError(w, message, status, jsonResponse)
+		return
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{limit.reader(r.Body), r.Body}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		uploadError(w, err.Error(), http.StatusBadRequest, jsonResponse)
+		return
+	}
+
+	// 逐个保存文件，单个文件失败不影响其他文件
+	var results []UploadResult
+	var paths []string
+	succeeded := 0
+
+	// 表单无法继续读取时（例如超出上传限制或连接中断）结束请求，已保存的文件保留并在结果中列出
+	streamError := func(err error) {
+		status, message := http.StatusBadRequest, err.Error()
+		switch {
+		case errors.Is(err, limit.err):
+			status, message = operationErrorStatus(limit.err)
+		case errors.Is(err, multipart.ErrMessageTooLarge):
+			status = http.StatusRequestEntityTooLarge
+		}
+		if len(results) == 0 {
+			uploadError(w, message, status, jsonResponse)
+			return
+		}
+		fs.writeUploadSummary(w, status, UploadSummary{Succeeded: succeeded, Failed: len(results) - succeeded, Results: results, Error: message}, jsonResponse)
+	}
+	fieldBytes := fs.options.MaxMemory // path 等普通字段最多读取的总字节数
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			streamError(err)
+			return
+		}
+
+		switch part.FormName() {
+		case "path":
+			// 对应的文件已经保存，不能再按此路径保存
+			if len(paths) < len(results) {
+				streamError(fmt.Errorf("%w, %s was saved without it", ErrPathAfterFile, results[len(paths)].Name))
+				return
+			}
+			value, err := io.ReadAll(io.LimitReader(part, fieldBytes+1))
+			if err == nil && int64(len(value)) > fieldBytes {
+				err = multipart.ErrMessageTooLarge
+			}
+			if err != nil {
+				streamError(err)
+				return
+			}
+			fieldBytes -= int64(len(value))
+			paths = append(paths, string(value))
+		case "file":
+			name := part.FileName()
+			if index := len(results); index < len(paths) && paths[index] != "" {
+				name = paths[index]
+			}
+			checksum := part.Header.Get(ChecksumHeader)
+			if checksum == "" && len(results) == 0 {
+				checksum = r.Header.Get(ChecksumHeader)
+			}
+			result, _ := fs.saveFile(name, part, -1, checksum)
+			if result.Error == "" {
+				succeeded++
+			}
+			results = append(results, result)
+		}
+		part.Close()
+	}
+	if len(results) == 0 {
+		uploadError(w, http.ErrMissingFile.Error(), http.StatusBadRequest, jsonResponse)
+		return
+	}
+
+	fs.writeUploadSummary(w, http.StatusOK, UploadSummary{Succeeded: succeeded, Failed: len(results) - succeeded, Results: results}, jsonResponse)
+}
+
+// writeUploadSummary 按客户端要求的格式输出上传结果
+//
+// 参数：
+//   - w: 响应
+//   - status: 状态码
+//   - summary: 上传结果
+//   - jsonResponse: 是否以 JSON 格式输出，否则输出结果页面
+func (fs *FileServer) writeUploadSummary(w http.ResponseWriter, status int, summary UploadSummary, jsonResponse bool) {
+	if jsonResponse {
+		writeJSON(w, status, summary)
+		return
+	}
+	fs.renderStatus(w, status, "result", map[string]interface{}{
+		"Navigation": fs.navigation(),
+		"Results":    summary.Results,
+		"Succeeded":  summary.Succeeded,
+		"Failed":     summary.Failed,
+		"Error":      summary.Error,
+	})
+}
+
+// wantsJSON 判断客户端是否要求以 JSON 格式返回结果（Accept 头包含 application/json）
+//
+// 参数：
+//   - r: 请求
+//
+// 返回：
+//   - 是否返回 JSON
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// uploadError 按客户端要求的格式输出上传错误
+//
+// 参数：
+//   - w: 响应
+//   - message: 错误信息
+//   - status: 状态码
+//   - jsonResponse: 是否以 JSON 格式输出
+func uploadError(w http.ResponseWriter, message string, status int, jsonResponse bool) {
+	if jsonResponse {
+		writeJSON(w, status, map[string]string{"error": message})
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// saveFile 将数据保存为服务目录中的文件，必要时创建中间目录，同时计算 SHA-256 校验和
+//
+// 参数：
+//   - name: 文件相对于服务目录的路径
+//   - src: 文件内容
+//   - size: 文件大小，未知时为 -1，用于在接收前检查上传限制
+//   - checksum: 客户端提供的校验和（格式见 ParseChecksum），为空时不校验，不一致时不保存文件
+//
+// 返回：
+//   - 上传结果，失败时 Error 字段为错误信息
+//   - 错误信息
+func (fs *FileServer) saveFile(name string, src io.Reader, size int64, checksum string) (result UploadResult, err error) {
+	result.Name = name
+	defer func() {
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}()
+
+	expected, err := ParseChecksum(checksum)
+	if err != nil {
+		return result, err
+	}
+
+	// 校验并解析目标路径，确保只会写入服务目录之中
+	relativePath, targetPath, err := ResolveUploadPath(fs.options.Dir, name)
+	if err != nil {
+		return result, err
+	}
+	result.Name = relativePath
+
+	// 拒绝策略下同名文件已存在时不必接收文件内容
+	if fs.options.OnConflict == ConflictReject && FileExist(targetPath) {
+		return result, ErrFileExists
+	}
+	limit, err := fs.uploadAllowance(size, 0)
+	if err != nil {
+		return result, err
+	}
+	// 接收期间逐步占用存储配额，并发的上传合计不会超出配额
+	reservation := fs.newReservation()
+	defer reservation.release()
+
+	// 先写入目标目录中的临时文件，接收完毕后再移动到目标位置，
+	// 失败时（例如连接中断或服务被强制关闭）删除临时文件，不会留下不完整的文件
+	if err := os.MkdirAll(filepath.Dir(targetPath), os.ModePerm); err != nil {
+		return result, err
+	}
+	tempFile, err := createTempFile(filepath.Dir(targetPath))
+	if err != nil {
+		return result, err
+	}
+	defer fs.transfers.begin()()
+	hash := sha256.New()
+	result.Size, err = io.Copy(io.MultiWriter(tempFile, hash), reservation.reader(limit.reader(src)))
+	if err == nil {
+		result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		if expected != "" && result.SHA256 != expected {
+			err = ErrChecksumMismatch
+		}
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		var finalPath string
+		if finalPath, err = fs.commitUpload(reservation, "", tempFile.Name(), targetPath, result.Size); err == nil {
+			result.Name = path.Join(path.Dir(relativePath), filepath.Base(finalPath))
+			fs.cacheChecksum(result.Name, finalPath, result.SHA256)
+		}
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	fs.transfers.addUpload(result.Size, err == nil)
+	return result, err
+}
+
+// createTempFile 在目录中创建用于接收上传内容的临时文件，文件名带有 InternalPrefix，不会出现在目录列表中
+//
+// 参数：
+//   - dir: 目录
+//
+// 返回：
+//   - 已打开的临时文件
+//   - 错误信息
+func createTempFile(dir string) (*os.File, error) {
+	random := make([]byte, 8)
+	for attempt := 0; attempt < 100; attempt++ {
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		// 不使用 os.CreateTemp，使上传的文件与直接创建的文件权限一致
+		tempPath := filepath.Join(dir, InternalPrefix+"upload-"+hex.EncodeToString(random)+".tmp")
+		file, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) {
+			return file, err
+		}
+	}
+	return nil, errors.New("Unable to create temporary file")
+}
+
+// commitUploadFile 按同名文件处理策略将接收完毕的文件移动到目标位置
+//
+// 先按策略占用目标文件名，再用接收完毕的文件替换它，并发上传同名文件时不会互相覆盖
+//
+// 参数：
+//   - sourcePath: 接收完毕的文件路径，需要与目标位置在同一文件系统中
+//   - targetPath: 目标文件路径
+//   - policy: 同名文件处理策略
+//
+// 返回：
+//   - 实际保存的文件路径（重命名策略下可能与 targetPath 不同）
+//   - 错误信息
+func commitUploadFile(sourcePath, targetPath, policy string) (string, error) {
+	if policy == ConflictOverwrite {
+		return targetPath, os.Rename(sourcePath, targetPath)
+	}
+	targetFile, finalPath, err := createUploadFile(targetPath, policy)
+	if err != nil {
+		return "", err
+	}
+	targetFile.Close()
+	if err := os.Rename(sourcePath, finalPath); err != nil {
+		os.Remove(finalPath)
+		return "", err
+	}
+	return finalPath, nil
+}
+
+// createUploadFile 按同名文件处理策略创建上传的目标文件
+//
+// 参数：
+//   - targetPath: 目标文件路径
+//   - policy: 同名文件处理策略
+//
+// 返回：
+//   - 已打开的目标文件
+//   - 实际创建的文件路径（重命名策略下可能与 targetPath 不同）
+//   - 错误信息
+func createUploadFile(targetPath, policy string) (*os.File, string, error) {
+	switch policy {
+	case ConflictOverwrite:
+		file, err := os.Create(targetPath)
+		return file, targetPath, err
+	case ConflictReject:
+		file, err := os.OpenFile(targetPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			err = ErrFileExists
+		}
+		return file, targetPath, err
+	default:
+		// 使用 O_EXCL 创建，避免并发上传同名文件时互相覆盖
+		candidate := targetPath
+		for number := 1; number <= maxRenameAttempts; number++ {
+			file, err := os.OpenFile(candidate, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+			if !os.IsExist(err) {
+				return file, candidate, err
+			}
+			candidate = numberedName(targetPath, number)
+		}
+		return nil, "", ErrFileExists
+	}
+}
+
+// numberedName 在文件名和扩展名之间插入序号，例如 "a.txt" 变为 "a (1).txt"，"a.tar.gz" 变为 "a (1).tar.gz"
+//
+// 参数：
+//   - filePath: 文件路径
+//   - number: 序号
+//
+// 返回：
+//   - 带序号的文件路径
+func numberedName(filePath string, number int) string {
+	dir, base := filepath.Split(filePath)
+	ext := filepath.Ext(base)
+	if ext == base {
+		ext = "" // 以 "." 开头且没有其他扩展名的文件，例如 ".bashrc"
+	}
+	stem := strings.TrimSuffix(base, ext)
+	if tarExt := filepath.Ext(stem); strings.EqualFold(tarExt, ".tar") && tarExt != stem {
+		stem = strings.TrimSuffix(stem, tarExt)
+		ext = tarExt + ext
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, number, ext))
+}
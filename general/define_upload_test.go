@@ -0,0 +1,258 @@
+/*
+File: define_upload_test.go
+Author: YJ
+Email: yj1516268@outlook.com
+Created Time: 2024-08-27 16:47:02
+
+Description: 表单上传的测试和吞吐量基准测试
+*/
+
+package general
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// formField 上传表单中的一个字段
+type formField struct {
+	name    string // 字段名，path 或 file
+	value   string // path 字段的值，或 file 字段的文件名
+	content []byte // file 字段的文件内容
+}
+
+// newUploadRequest 生成上传表单请求
+//
+// 参数：
+//   - fields: 按顺序排列的表单字段
+//
+// 返回：
+//   - 请求体
+//   - Content-Type 请求头
+func newUploadRequest(fields ...formField) ([]byte, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, field := range fields {
+		if field.name == "file" {
+			part, _ := writer.CreateFormFile("file", field.value)
+			part.Write(field.content)
+		} else {
+			writer.WriteField(field.name, field.value)
+		}
+	}
+	writer.Close()
+	return body.Bytes(), writer.FormDataContentType()
+}
+
+// postUpload 向服务发送上传表单请求，要求返回 JSON
+//
+// 参数：
+//   - handler: 请求处理器
+//   - body: 请求体
+//   - contentType: Content-Type 请求头
+//
+// 返回：
+//   - 响应
+func postUpload(handler http.Handler, body []byte, contentType string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestUploadPathOrder(t *testing.T) {
+	content := []byte("content")
+	tests := []struct {
+		name   string
+		fields []formField
+		status int
+		saved  []string // 期望保存的文件，按路径排序
+	}{
+		{
+			"path before file",
+			[]formField{{"path", "a/x.txt", nil}, {"file", "x.txt", content}, {"path", "b/y.txt", nil}, {"file", "y.txt", content}},
+			http.StatusOK, []string{"a/x.txt", "b/y.txt"},
+		},
+		{
+			"without path",
+			[]formField{{"file", "x.txt", content}, {"file", "y.txt", content}},
+			http.StatusOK, []string{"x.txt", "y.txt"},
+		},
+		{
+			"empty path",
+			[]formField{{"path", "", nil}, {"file", "x.txt", content}, {"path", "b/y.txt", nil}, {"file", "y.txt", content}},
+			http.StatusOK, []string{"b/y.txt", "x.txt"},
+		},
+		{
+			"path after file",
+			[]formField{{"file", "x.txt", content}, {"path", "a/x.txt", nil}},
+			http.StatusBadRequest, []string{"x.txt"},
+		},
+		{
+			"paths after files",
+			[]formField{{"path", "a/x.txt", nil}, {"file", "x.txt", content}, {"file", "y.txt", content}, {"path", "b/y.txt", nil}, {"file", "z.txt", content}},
+			http.StatusBadRequest, []string{"a/x.txt", "y.txt"},
+		},
+		{
+			"no file",
+			[]formField{{"path", "a/x.txt", nil}},
+			http.StatusBadRequest, nil,
+		},
+	}
+	for _, test := range tests {
+		fileServer := newTestFileServer(t, ServerOptions{})
+		body, contentType := newUploadRequest(test.fields...)
+		recorder := postUpload(fileServer.Handler(), body, contentType)
+		if recorder.Code != test.status {
+			t.Errorf("%s: status = %d, want %d: %s", test.name, recorder.Code, test.status, recorder.Body)
+		}
+		var summary UploadSummary
+		if err := json.NewDecoder(recorder.Body).Decode(&summary); err != nil {
+			t.Errorf("%s: invalid response: %v", test.name, err)
+		}
+		if test.status != http.StatusOK && summary.Error == "" {
+			t.Errorf("%s: missing error message", test.name)
+		}
+
+		// 出错时已保存的文件也在结果中列出，与服务目录中的文件一致
+		var reported []string
+		for _, result := range summary.Results {
+			if result.Error == "" {
+				reported = append(reported, result.Name)
+			}
+		}
+		sort.Strings(reported)
+		saved := savedFiles(fileServer.options.Dir)
+		if strings.Join(saved, ",") != strings.Join(test.saved, ",") {
+			t.Errorf("%s: saved files = %v, want %v", test.name, saved, test.saved)
+		}
+		if strings.Join(reported, ",") != strings.Join(saved, ",") {
+			t.Errorf("%s: reported files = %v, saved files = %v", test.name, reported, saved)
+		}
+	}
+}
+
+func TestUploadPathAfterFilePage(t *testing.T) {
+	fileServer := newTestFileServer(t, ServerOptions{})
+	body, contentType := newUploadRequest(formField{"file", "x.txt", []byte("content")}, formField{"path", "a/x.txt", nil})
+	request := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	fileServer.Handler().ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	page := recorder.Body.String()
+	for _, want := range []string{ErrPathAfterFile.Error(), "x.txt (7 bytes)"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Result page is missing %q:\n%s", want, page)
+		}
+	}
+	if saved := savedFiles(fileServer.options.Dir); strings.Join(saved, ",") != "x.txt" {
+		t.Errorf("Saved files = %v, want [x.txt]", saved)
+	}
+}
+
+// savedFiles 列出服务目录中的文件
+//
+// 参数：
+//   - root: 服务目录
+//
+// 返回：
+//   - 以 "/" 分隔的相对路径，按路径排序
+func savedFiles(root string) []string {
+	var saved []string
+	filepath.WalkDir(root, func(filePath string, entry os.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			relativePath, _ := filepath.Rel(root, filePath)
+			saved = append(saved, filepath.ToSlash(relativePath))
+		}
+		return nil
+	})
+	return saved
+}
+
+// handleBufferedUpload 使用 ParseMultipartForm 接收上传表单，文件先缓存到内存或系统临时目录后再复制到服务目录，
+// 是改为流式读取之前的实现，用于与 handleUpload 比较吞吐量
+//
+// 参数：
+//   - fs: HTTP 文件服务
+//
+// 返回：
+//   - 请求处理器
+func handleBufferedUpload(fs *FileServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(fs.options.MaxMemory); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+		paths := r.MultipartForm.Value["path"]
+		var results []UploadResult
+		for index, fileHeader := range r.MultipartForm.File["file"] {
+			name := fileHeader.Filename
+			if index < len(paths) && paths[index] != "" {
+				name = paths[index]
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result, _ := fs.saveFile(name, file, fileHeader.Size, fileHeader.Header.Get(ChecksumHeader))
+			file.Close()
+			results = append(results, result)
+		}
+		writeJSON(w, http.StatusOK, UploadSummary{Succeeded: len(results), Results: results})
+	}
+}
+
+// benchmarkUpload 测试上传表单的吞吐量
+//
+// 参数：
+//   - b: 基准测试
+//   - handler: 根据服务创建请求处理器
+func benchmarkUpload(b *testing.B, handler func(*FileServer) http.Handler) {
+	for _, size := range []int64{1 << 20, 64 << 20} {
+		b.Run(FormatSize(size), func(b *testing.B) {
+			fileServer := newTestFileServer(b, ServerOptions{OnConflict: ConflictOverwrite})
+			content := bytes.Repeat([]byte("0123456789abcdef"), int(size/16))
+			body, contentType := newUploadRequest(formField{"path", "bench.bin", nil}, formField{"file", "bench.bin", content})
+			serve := handler(fileServer)
+
+			b.SetBytes(size)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				recorder := postUpload(serve, body, contentType)
+				if recorder.Code != http.StatusOK {
+					b.Fatalf("Status = %d: %s", recorder.Code, recorder.Body)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUploadStreaming 使用 multipart.Reader 直接写入服务目录的吞吐量
+func BenchmarkUploadStreaming(b *testing.B) {
+	benchmarkUpload(b, func(fs *FileServer) http.Handler {
+		return http.HandlerFunc(fs.handleUpload)
+	})
+}
+
+// BenchmarkUploadParseMultipartForm 使用 ParseMultipartForm 先缓存再复制的吞吐量
+func BenchmarkUploadParseMultipartForm(b *testing.B) {
+	benchmarkUpload(b, func(fs *FileServer) http.Handler {
+		return handleBufferedUpload(fs)
+	})
+}
@@ -10,13 +10,20 @@ Description: 子命令 'gui' 的实现
 package gui
 
 import (
+	"fmt"
+	"log"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/flopp/go-findfont"
+	"github.com/yhyj/skynet/general"
 )
 
 // makeCustomDialog 生成自定义对话框
@@ -38,6 +45,65 @@ func makeCustomDialog(title, dismiss, text string, size fyne.Size, parent fyne.W
 	return customDialog
 }
 
+// makeDiscoverWindow 生成局域网服务发现窗口，窗口显示时自动查找一次，点击列表项在浏览器中打开服务
+//
+// 参数：
+//   - appInstance: 应用
+//   - size: 窗口大小
+//
+// 返回：
+//   - 窗口对象
+func makeDiscoverWindow(appInstance fyne.App, size fyne.Size) fyne.Window {
+	discoverWindow := appInstance.NewWindow("LAN Servers")
+	discoverWindow.Resize(size)
+
+	var servers []general.DiscoveredServer // 已发现的服务
+	statusLabel := widget.NewLabel("")     // 查找状态
+	var refreshButton *widget.Button       // 重新查找按钮
+
+	// 服务列表，每项显示实例名、URL、服务类型和认证方式
+	serverList := widget.NewList(
+		func() int { return len(servers) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			server := servers[id]
+			item.(*widget.Label).SetText(fmt.Sprintf("%s  %s  [%s, auth: %s]", server.Instance, server.URL(), server.Mode, server.Auth))
+		},
+	)
+	serverList.OnSelected = func(id widget.ListItemID) {
+		serverList.Unselect(id)
+		serverUrl, err := url.Parse(servers[id].URL())
+		if err != nil {
+			log.Println(general.FgRedText(err))
+			return
+		}
+		appInstance.OpenURL(serverUrl)
+		log.Printf("Open URL: %s", general.FgBlueText(serverUrl))
+	}
+
+	// 在后台查找服务，避免阻塞界面
+	discover := func() {
+		refreshButton.Disable()
+		statusLabel.SetText(fmt.Sprintf("Searching for %s servers...", general.DiscoveryService))
+		go func() {
+			found, err := general.Discover(2 * time.Second)
+			if err != nil {
+				statusLabel.SetText(err.Error())
+			} else {
+				servers = found
+				statusLabel.SetText(fmt.Sprintf("Found %d server(s), click to open", len(servers)))
+			}
+			serverList.Refresh()
+			refreshButton.Enable()
+		}()
+	}
+	refreshButton = widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), discover)
+
+	discoverWindow.SetContent(container.NewBorder(container.NewBorder(nil, nil, nil, refreshButton, statusLabel), nil, nil, nil, serverList))
+	discover()
+	return discoverWindow
+}
+
 // SetFont 设置 Fyne 使用的字体
 //
 // 返回：
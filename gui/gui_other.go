@@ -14,8 +14,8 @@ package gui
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
-	"net/http"
 	"net/url"
 	"path/filepath"
 	"strconv"
@@ -35,7 +35,10 @@ import (
 )
 
 // StartGraphicalUserInterface 启动 GUI
-func StartGraphicalUserInterface() {
+//
+// 参数：
+//   - config: 配置，用于填充各部件的默认值
+func StartGraphicalUserInterface(config *general.Config) {
 	// 获取当前用户信息
 	currentUserInfo, err := general.GetCurrentUserInfo()
 	if err != nil {
@@ -48,20 +51,42 @@ func StartGraphicalUserInterface() {
 		defaultPort  = "8080"                                                // HTTP 服务默认监听的端口
 		defaultDir   = filepath.Join(currentUserInfo.HomeDir, "Downloads")   // HTTP 服务默认启动路径
 		serviceUrl   = color.Sprintf("http://%s:%s", defaultIP, defaultPort) // HTTP 服务默认 URL
-		serviceSlice = []string{"Download", "Upload", "All"}                 // HTTP 服务默认支持启用的方法
+		serviceSlice = general.ServiceModes                                  // HTTP 服务默认支持启用的方法
 	)
 
+	// 使用配置文件中的值覆盖默认配置
+	if config.Http.Port >= 1 && config.Http.Port <= 65535 {
+		defaultPort = strconv.Itoa(config.Http.Port)
+	}
+	if config.Http.Dir != "" {
+		defaultDir = strings.Replace(config.Http.Dir, "~", currentUserInfo.HomeDir, 1)
+	}
+	maxMemory, err := general.ParseSize(config.Upload.MaxMemory)
+	if err != nil {
+		log.Println(general.FgRedText(err))
+	}
+	uploadLimits, err := general.ParseUploadLimits(config.Upload)
+	if err != nil {
+		log.Println(general.FgRedText(err))
+	}
+
 	// 界面显示配置
 	var (
 		serviceLabelText   = "Select Service:"                                                                                    // 服务选择标签默认文本
+		conflictLabelText  = "On Conflict:"                                                                                       // 同名文件处理策略选择标签默认文本
+		permissionText     = "Permissions:"                                                                                       // 操作权限选择标签默认文本
 		interfaceLabelText = "Select Interface:"                                                                                  // 网卡选择标签默认文本
 		portText           = color.Sprintf("Port [1~65535], default %s", defaultPort)                                             // 端口框默认文本
 		selectedDirText    = color.Sprintf("Directory, default %s", strings.Replace(defaultDir, currentUserInfo.HomeDir, "~", 1)) // 服务启动路径框默认文本
+		passwordText       = "Password, empty to disable"                                                                         // 密码框默认文本
+		tokenText          = "Require access token"                                                                               // 访问令牌选择框文本
+		tlsText            = "HTTPS"                                                                                              // HTTPS 选择框文本
 	)
 
 	// 定义服务接口和小部件
 	var (
-		httpServer      *http.Server                // HTTP 服务
+		fileServer      *general.FileServer         // HTTP 服务
+		advertiser      *general.Advertiser         // 局域网服务广播
 		qrWindow        fyne.Window                 // 二维码窗口
 		windowContent   *fyne.Container             // 窗口内容容器
 		refreshButton   *widget.Button              // 接口刷新按钮
@@ -69,6 +94,7 @@ func StartGraphicalUserInterface() {
 		qrButton        *widget.Button              // 二维码显示/隐藏按钮
 		statusAnimation *widget.ProgressBarInfinite // HTTP 服务状态动画
 		urlButton       *widget.Button              // 打开 URL 按钮
+		discoverButton  *widget.Button              // 局域网服务发现按钮
 		controlButton   *widget.Button              // 服务的启动/停止按钮
 		customDialog    *dialog.CustomDialog        // 自定义对话框
 	)
@@ -109,6 +135,13 @@ func StartGraphicalUserInterface() {
 	}
 	// 创建网络接口选择器（单选按钮组）
 	interfaceRadio := widget.NewRadioGroup(nicInfos, func(selected string) {})
+	for _, nicInfo := range nicInfos {
+		parts := strings.Split(nicInfo, " ")
+		if (config.Http.Bind == "" && parts[0] == config.Http.Interface) || (config.Http.Bind != "" && parts[len(parts)-1] == config.Http.Bind) {
+			interfaceRadio.SetSelected(nicInfo)
+			break
+		}
+	}
 	// 创建网络接口刷新按钮
 	refreshButton = widget.NewButtonWithIcon("", theme.ViewRefreshIcon(), func() {
 		nicInfos, err := general.GetNetInterfacesForGUI()
@@ -174,6 +207,50 @@ func StartGraphicalUserInterface() {
 	// 创建服务选择器
 	serviceSelect := widget.NewSelect(serviceSlice, func(selected string) {})
 	serviceSelect.Selected = serviceSlice[0]
+	for _, service := range serviceSlice {
+		if strings.EqualFold(service, config.Http.Mode) {
+			serviceSelect.Selected = service
+			break
+		}
+	}
+
+	// 创建操作权限选择标签
+	permissionLabel := widget.NewLabel(permissionText)
+	// 创建操作权限选择组，默认使用配置文件中的权限，未配置时使用所选服务类型的默认权限
+	permissionGroup := widget.NewCheckGroup(general.PermissionNames, func(selected []string) {})
+	permissionGroup.Horizontal = true
+	permissions, err := general.ParsePermissions(config.Http.Permissions)
+	if err != nil {
+		log.Println(general.FgRedText(err))
+	}
+	if permissions == (general.Permissions{}) {
+		permissions = general.ModePermissions(serviceSelect.Selected)
+	}
+	permissionGroup.SetSelected(permissions.Names())
+	// 切换服务类型时使用其默认权限
+	serviceSelect.OnChanged = func(selected string) {
+		permissionGroup.SetSelected(general.ModePermissions(selected).Names())
+	}
+
+	// 创建同名文件处理策略选择标签
+	conflictSelectLabel := widget.NewLabel(conflictLabelText)
+	// 创建同名文件处理策略选择器
+	conflictSelect := widget.NewSelect(general.ConflictPolicies, func(selected string) {})
+	conflictSelect.Selected = general.ConflictRename
+	if onConflict, err := general.ParseConflictPolicy(config.Upload.OnConflict); err == nil {
+		conflictSelect.Selected = onConflict
+	}
+
+	// 创建密码输入框
+	passwordEntry := widget.NewPasswordEntry()
+	passwordEntry.SetPlaceHolder(passwordText)
+	passwordEntry.SetText(config.Auth.Password)
+	// 创建访问令牌选择框
+	tokenCheck := widget.NewCheck(tokenText, func(checked bool) {})
+	tokenCheck.SetChecked(config.Auth.Token)
+	// 创建 HTTPS 选择框
+	tlsCheck := widget.NewCheck(tlsText, func(checked bool) {})
+	tlsCheck.SetChecked(config.TLS.Enable)
 
 	// 创建URL打开按钮
 	urlButton = widget.NewButtonWithIcon("", theme.MailSendIcon(), func() {
@@ -187,6 +264,11 @@ func StartGraphicalUserInterface() {
 	})
 	urlButton.Disable() // 禁用 URL 按钮
 
+	// 创建局域网服务发现按钮
+	discoverButton = widget.NewButtonWithIcon("", theme.SearchIcon(), func() {
+		makeDiscoverWindow(appInstance, fyne.NewSize(baseWeight, baseWeight/2)).Show()
+	})
+
 	// 创建服务状态显示动画
 	statusAnimation = widget.NewProgressBarInfinite()
 
@@ -240,18 +322,16 @@ func StartGraphicalUserInterface() {
 			return defaultDir
 		}()
 
-		serviceUrl = color.Sprintf("http://%s:%s", selectedInterfaceIP, selectedPort)
-
-		// 生成二维码
-		qrCodeImage, err := general.QrCodeImage(serviceUrl)
-		if err != nil {
-			customDialog = makeCustomDialog("Error", "Close", err.Error(), customDialogSize, mainWindow)
-			customDialog.Show()
-		}
-		// 将二维码图像转换为 Fyne 图像
-		qrImage := canvas.NewImageFromImage(qrCodeImage)
-		// 设置图像填充模式为 ImageFillOriginal ，以确保不拉伸
-		qrImage.FillMode = canvas.ImageFillOriginal
+		selectedToken := func() string {
+			if !tokenCheck.Checked {
+				return ""
+			}
+			token, err := general.GenerateToken()
+			if err != nil {
+				log.Println(general.FgRedText(err))
+			}
+			return token
+		}()
 
 		// 刷新服务状态动画
 		statusAnimation.Refresh() // 否则第一次不会启动
@@ -259,29 +339,94 @@ func StartGraphicalUserInterface() {
 		switch serviceStatus {
 		case 0: // Start
 			// 启动 HTTP 服务
-			switch selectedService {
-			case "Download":
-				httpServer, err = general.HttpDownloadServerForGUI(selectedInterfaceIP, selectedPort, selectedDir)
-			case "Upload":
-				httpServer, err = general.HttpUploadServerForGUI(selectedInterfaceIP, selectedPort, selectedDir)
-			case "All":
-				httpServer, err = general.HttpAllServerForGUI(selectedInterfaceIP, selectedPort, selectedDir)
-			default:
-				customDialog = makeCustomDialog("Warning", "Close", "Please select service", customDialogSize, mainWindow)
-				customDialog.Show()
+			selectedPermissions, _ := general.ParsePermissions(permissionGroup.Selected)
+			// 打开访问日志，服务结束时关闭
+			logConfig := config.Log
+			logConfig.File = strings.Replace(logConfig.File, "~", currentUserInfo.HomeDir, 1)
+			var accessLog io.Writer
+			var closeAccessLog func() error
+			accessLog, closeAccessLog, err = general.OpenAccessLog(logConfig)
+			if err == nil {
+				fileServer, err = general.NewFileServer(general.ServerOptions{
+					Mode:        selectedService,
+					Permissions: selectedPermissions,
+					Address:     selectedInterfaceIP,
+					Port:        selectedPort,
+					Dir:         selectedDir,
+					MaxMemory:   maxMemory,
+					Limits:      uploadLimits,
+					OnConflict:  conflictSelect.Selected,
+					Username:    config.Auth.Username,
+					Password:    passwordEntry.Text,
+					Token:       selectedToken,
+					TLS:         tlsCheck.Checked,
+					CertFile:    config.TLS.Cert,
+					KeyFile:     config.TLS.Key,
+					ThemeDir:    strings.Replace(config.Http.ThemeDir, "~", currentUserInfo.HomeDir, 1),
+					AccessLog:   accessLog,
+					LogFormat:   logConfig.Format,
+				})
+			}
+			if err == nil {
+				err = fileServer.Start(context.Background())
+			}
+			if err == nil {
+				// 服务结束时输出日志
+				go func(server *general.FileServer, closeAccessLog func() error) {
+					if err := server.Wait(); err != nil {
+						log.Printf("%s\n", general.DangerText("HTTP server error: ", err))
+					} else {
+						log.Println(general.FgYellowText("HTTP Server closed"))
+					}
+					closeAccessLog()
+				}(fileServer, closeAccessLog)
+			} else {
+				closeAccessLog()
 			}
 			if err != nil {
 				customDialog = makeCustomDialog("Error", "Close", err.Error(), customDialogSize, mainWindow)
 				customDialog.Show()
 			} else {
+				// 分享地址包含访问令牌
+				serviceUrl = fileServer.ShareURL()
+				// 生成二维码
+				qrCodeImage, err := general.QrCodeImage(serviceUrl)
+				if err != nil {
+					customDialog = makeCustomDialog("Error", "Close", err.Error(), customDialogSize, mainWindow)
+					customDialog.Show()
+				}
+				// 将二维码图像转换为 Fyne 图像
+				qrImage := canvas.NewImageFromImage(qrCodeImage)
+				// 设置图像填充模式为 ImageFillOriginal ，以确保不拉伸
+				qrImage.FillMode = canvas.ImageFillOriginal
+				var qrContent fyne.CanvasObject = qrImage
+				// 启用 HTTPS 时在二维码下方显示证书指纹，供用户核对
+				fingerprint := fileServer.Fingerprint()
+				if fingerprint != "" {
+					fingerprintLabel := widget.NewLabel("SHA-256: " + fingerprint)
+					fingerprintLabel.Wrapping = fyne.TextWrapBreak
+					fingerprintLabel.TextStyle = fyne.TextStyle{Monospace: true}
+					qrContent = container.NewBorder(nil, fingerprintLabel, nil, nil, qrImage)
+				}
 				// 设置服务状态
 				serviceStatus = 1             // 服务已启动
 				controlButton.SetText("Stop") // 修改按钮文字
 				statusAnimation.Start()       // 启动服务状态动画
 				log.Printf("Starting HTTP [%s] server at '%s'\n", general.SuccessText(selectedService), general.FgCyanText(selectedDir))
 				log.Printf("HTTP server url is %s\n", general.FgBlueText(serviceUrl))
+				if fingerprint != "" {
+					log.Printf("Certificate SHA-256 fingerprint is %s\n", general.FgYellowText(fingerprint))
+				}
+				// 在局域网中广播服务，失败时不影响服务运行
+				if config.Http.Advertise {
+					if advertiser, err = fileServer.Advertise(); err != nil {
+						log.Printf("%s\n", general.WarnText("Unable to advertise on the local network: ", err))
+					} else {
+						log.Printf("Advertising as %s on the local network\n", general.FgYellowText(general.DiscoveryService))
+					}
+				}
 				// 设置二维码状态
-				qrWindow.SetContent(qrImage)                // 将二维码图像添加到窗口（NOTE: 不能使用 container.NewCenter() 函数将其添加到窗口中心，否则会产生内边距）
+				qrWindow.SetContent(qrContent)              // 将二维码图像添加到窗口（NOTE: 不能使用 container.NewCenter() 函数将其添加到窗口中心，否则会产生内边距）
 				qrWindow.SetPadded(false)                   // 设置窗口内边距为零以确保图像与窗口边框贴合
 				qrWindow.Show()                             // 显示二维码窗口
 				qrButton.Enable()                           // 启用二维码显示/隐藏按钮
@@ -291,17 +436,24 @@ func StartGraphicalUserInterface() {
 				urlButton.Enable() // 启用URL按钮
 				// 以下部件禁用
 				serviceSelect.Disable()    // 服务选择器
+				conflictSelect.Disable()   // 同名文件处理策略选择器
+				permissionGroup.Disable()  // 操作权限选择组
+				passwordEntry.Disable()    // 密码输入框
+				tokenCheck.Disable()       // 访问令牌选择框
+				tlsCheck.Disable()         // HTTPS 选择框
 				interfaceRadio.Disable()   // 网卡选择器
 				portEntry.Disable()        // 端口输入框
 				selectedDirEntry.Disable() // 目录输入框
 				folderButton.Disable()     // 目录选择按钮
 			}
 		case 1: // Stop
-			// 加锁，确保只有一个 goroutine 能够关闭 HTTP 服务器和注销路由
-			general.ServerMutex.Lock()
-			defer general.ServerMutex.Unlock()
+			// 停止局域网服务广播
+			if advertiser != nil {
+				advertiser.Close()
+				advertiser = nil
+			}
 			// 停止 HTTP 服务
-			if err := httpServer.Shutdown(context.TODO()); err != nil {
+			if err := fileServer.Shutdown(context.TODO()); err != nil {
 				customDialog = makeCustomDialog("Error", "Close", err.Error(), customDialogSize, mainWindow)
 				customDialog.Show()
 			}
@@ -318,6 +470,11 @@ func StartGraphicalUserInterface() {
 			urlButton.Disable() // 禁用 URL 按钮
 			// 以下部件启用
 			serviceSelect.Enable()    // 服务选择器
+			conflictSelect.Enable()   // 同名文件处理策略选择器
+			permissionGroup.Enable()  // 操作权限选择组
+			passwordEntry.Enable()    // 密码输入框
+			tokenCheck.Enable()       // 访问令牌选择框
+			tlsCheck.Enable()         // HTTPS 选择框
 			interfaceRadio.Enable()   // 网卡选择器
 			portEntry.Enable()        // 端口输入框
 			selectedDirEntry.Enable() // 目录输入框
@@ -350,25 +507,34 @@ func StartGraphicalUserInterface() {
 
 	// 多态行 —— 服务选择标签 + 服务选择器
 	crossServiceRow := container.NewBorder(nil, nil, serviceSelectLabel, nil, serviceSelect)
+	// 多态行 —— 操作权限选择标签 + 操作权限选择组
+	crossPermissionRow := container.NewBorder(nil, nil, permissionLabel, nil, permissionGroup)
+	// 多态行 —— 同名文件处理策略选择标签 + 同名文件处理策略选择器
+	crossConflictRow := container.NewBorder(nil, nil, conflictSelectLabel, nil, conflictSelect)
+	// 多态行 —— 密码输入框 + 访问令牌选择框 + HTTPS 选择框
+	crossAuthRow := container.NewBorder(nil, nil, nil, container.NewHBox(tokenCheck, tlsCheck), passwordEntry)
 	// 多态行 —— 接口选择标签 + 接口刷新按钮
 	crossInterfaceRow := container.NewBorder(nil, nil, interfaceLabel, refreshButton, nil)
 	// 多态行 —— 服务路径选择按钮 + 已选路径显示框
 	crossDirRow := container.NewBorder(nil, nil, folderButton, nil, selectedDirEntry)
-	// 多态行 —— 二维码显示/隐藏按钮 + 服务链接打开按钮 + 状态动画
-	crossStatusRow := container.NewBorder(nil, nil, qrButton, urlButton, statusAnimation)
+	// 多态行 —— 二维码显示/隐藏按钮 + 服务链接打开按钮 + 局域网服务发现按钮 + 状态动画
+	crossStatusRow := container.NewBorder(nil, nil, qrButton, container.NewHBox(urlButton, discoverButton), statusAnimation)
 
 	// 填充主窗口
 	windowContent = container.NewVBox(
-		crossServiceRow,   // 多态行 —— 服务选择标签 + 服务选择器
-		crossInterfaceRow, // 多态行 —— 接口选择标签 + 接口刷新按钮
-		interfaceRadio,    // 接口选择
-		spacer,            // 填充空白
-		portEntry,         // 端口配置
-		crossDirRow,       // 多态行 —— 服务路径选择按钮 + 已选路径显示框
-		separator,         // 分隔线
-		crossStatusRow,    // 多态行 —— 二维码显示/隐藏按钮 + 服务链接打开按钮 + 状态动画
-		separator,         // 分隔线
-		controlButton,     // 启动按钮
+		crossServiceRow,    // 多态行 —— 服务选择标签 + 服务选择器
+		crossPermissionRow, // 多态行 —— 操作权限选择标签 + 操作权限选择组
+		crossConflictRow,   // 多态行 —— 同名文件处理策略选择标签 + 同名文件处理策略选择器
+		crossInterfaceRow,  // 多态行 —— 接口选择标签 + 接口刷新按钮
+		interfaceRadio,     // 接口选择
+		spacer,             // 填充空白
+		portEntry,          // 端口配置
+		crossDirRow,        // 多态行 —— 服务路径选择按钮 + 已选路径显示框
+		crossAuthRow,       // 多态行 —— 密码输入框 + 访问令牌选择框 + HTTPS 选择框
+		separator,          // 分隔线
+		crossStatusRow,     // 多态行 —— 二维码显示/隐藏按钮 + 服务链接打开按钮 + 局域网服务发现按钮 + 状态动画
+		separator,          // 分隔线
+		controlButton,      // 启动按钮
 	)
 	mainWindow.SetContent(windowContent)
 